@@ -38,17 +38,25 @@ func NewAgentNode(id string, agent *agent.Agent) *AgentNode {
 	}
 }
 
+// Usage returns the token usage and estimated cost of the node's agent.
+func (node *AgentNode) Usage() agent.UsageStats {
+	return node.agent.Usage()
+}
+
 // NetAgent manages a graph of agent nodes and their connections.
 type NetAgent struct {
 	nodes    map[string]*AgentNode
 	inEdges  map[string]map[string]struct{}
 	outEdges map[string]map[string]struct{}
 	router   RouteFunc
+	budget   *agent.BudgetTracker
 	ctx      context.Context
 	cancel   context.CancelFunc
 	started  bool
 	wg       sync.WaitGroup
 	mu       sync.RWMutex
+
+	sendApproval bool // set by RequireSendApproval
 }
 
 // selfID: 当前处理消息的节点 ID
@@ -81,6 +89,12 @@ func (n *NetAgent) AddNode(id string, a *agent.Agent) (*AgentNode, error) {
 	n.inEdges[id] = make(map[string]struct{})
 	n.outEdges[id] = make(map[string]struct{})
 	n.attachCommTools(id, a)
+	if n.budget != nil {
+		a.SetSharedBudget(n.budget)
+	}
+	if n.sendApproval {
+		a.RequireApproval("send")
+	}
 	if n.started {
 		n.startNodeLoop(node)
 	}
@@ -177,6 +191,45 @@ func (n *NetAgent) GetOutNodes(id string) ([]*AgentNode, bool) {
 	return nodes, true
 }
 
+// Usage returns the usage of every node and the total over the network.
+func (n *NetAgent) Usage() (map[string]agent.UsageStats, agent.UsageStats) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	perNode := make(map[string]agent.UsageStats, len(n.nodes))
+	var total agent.UsageStats
+	for id, node := range n.nodes {
+		stats := node.Usage()
+		perNode[id] = stats
+		total = total.Add(stats)
+	}
+	return perNode, total
+}
+
+// SetSharedBudget puts every node, including nodes added later, under one
+// budget and returns its tracker. Once it is used up every node's
+// invocations fail with agent.ErrBudgetExceeded.
+func (n *NetAgent) SetSharedBudget(budget agent.Budget) *agent.BudgetTracker {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.budget = agent.NewBudgetTracker(budget)
+	for _, node := range n.nodes {
+		node.agent.SetSharedBudget(n.budget)
+	}
+	return n.budget
+}
+
+// RequireSendApproval makes the send tool of every node, including nodes
+// added later, require approval. Give each node's agent an approver with
+// SetApprover, or its sends are denied.
+func (n *NetAgent) RequireSendApproval() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sendApproval = true
+	for _, node := range n.nodes {
+		node.agent.RequireApproval("send")
+	}
+}
+
 func (n *NetAgent) SetRouter(router RouteFunc) {
 	n.mu.Lock()
 	n.router = router
@@ -363,6 +416,7 @@ func latestContent(msgs []Message) string {
 	return ""
 }
 
+// attachCommTools registers the send tool on a node's agent.
 func (n *NetAgent) attachCommTools(nodeID string, a *agent.Agent) {
 	if a == nil {
 		return
@@ -2,8 +2,11 @@ package netagent
 
 import (
 	"agent"
+	"agent/llm"
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"testing"
 	"time"
 )
@@ -26,11 +29,11 @@ func TestCommunication(t *testing.T) {
 		cfg.Model = "gpt-4o-mini"
 	}
 
-	a1 := agent.NewAgent(cfg.APIKey, cfg.BaseURL, cfg.Model, true)
+	a1 := agent.NewAgent(llm.NewOpenAIChatModel(cfg.APIKey, cfg.BaseURL, cfg.Model), true)
 	a1.AddSystemPrompt("You are node A. Reply in the format: A_ACK: <content>.")
-	a2 := agent.NewAgent(cfg.APIKey, cfg.BaseURL, cfg.Model, true)
+	a2 := agent.NewAgent(llm.NewOpenAIChatModel(cfg.APIKey, cfg.BaseURL, cfg.Model), true)
 	a2.AddSystemPrompt("You are node B. Reply in the format: B_ACK: <content>.")
-	a3 := agent.NewAgent(cfg.APIKey, cfg.BaseURL, cfg.Model, true)
+	a3 := agent.NewAgent(llm.NewOpenAIChatModel(cfg.APIKey, cfg.BaseURL, cfg.Model), true)
 	a3.AddSystemPrompt("You are node C. Reply in the format: C_ACK: <content>.")
 
 	if _, err := net.AddNode("A", a1); err != nil {
@@ -74,3 +77,71 @@ func TestCommunication(t *testing.T) {
 	time.Sleep(time.Minute * 5)
 	net.Stop()
 }
+
+// scriptedChatModel replies with one scripted response per call.
+type scriptedChatModel struct {
+	mu        sync.Mutex
+	responses []llm.Response
+}
+
+func (m *scriptedChatModel) Chat(_ context.Context, _ llm.Request) (*llm.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.responses) == 0 {
+		return nil, fmt.Errorf("scripted model: no response left")
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return &resp, nil
+}
+
+func (m *scriptedChatModel) ChatStream(ctx context.Context, req llm.Request, _ llm.StreamFunc) (*llm.Response, error) {
+	return m.Chat(ctx, req)
+}
+
+func (*scriptedChatModel) ModelName() string { return "scripted" }
+
+func sendingAgent() *agent.Agent {
+	return agent.NewAgent(&scriptedChatModel{responses: []llm.Response{
+		{Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "send", Arguments: `{"to_id":"B","content":"hi"}`}}}},
+		{Message: llm.Message{Role: llm.RoleAssistant, Content: "sent"}},
+	}}, true)
+}
+
+func TestSendApprovalIsOptIn(t *testing.T) {
+	net := NewNetAgent()
+	if _, err := net.AddNode("A", sendingAgent()); err != nil {
+		t.Fatalf("AddNode A: %v", err)
+	}
+	nodeB, _ := net.AddNode("B", agent.NewAgent(&scriptedChatModel{}, true))
+	if err := net.AddEdge("A", "B"); err != nil {
+		t.Fatalf("AddEdge: %v", err)
+	}
+	nodeA, _ := net.GetNode("A")
+	if _, err := nodeA.agent.Invoke(context.Background(), "greet B"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	select {
+	case msgs := <-nodeB.InputChan:
+		if len(msgs) != 1 || msgs[0].Content != "hi" || msgs[0].FromNodeID != "A" {
+			t.Fatalf("B received %+v", msgs)
+		}
+	default:
+		t.Fatal("send without an approver was not delivered")
+	}
+
+	// Once required, a node without an approver cannot send.
+	net.RequireSendApproval()
+	nodeC, _ := net.AddNode("C", sendingAgent())
+	if err := net.AddEdge("C", "B"); err != nil {
+		t.Fatalf("AddEdge: %v", err)
+	}
+	if _, err := nodeC.agent.Invoke(context.Background(), "greet B"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	select {
+	case msgs := <-nodeB.InputChan:
+		t.Fatalf("send delivered without approval: %+v", msgs)
+	default:
+	}
+}
@@ -2,66 +2,171 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"agent/llm"
+	"agent/memory"
 	"agent/tools"
-
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 )
 
 const (
-	DefaultName              string  = "Base_agent"
-	DefaultDescription       string  = "The basic for the extended intelligent agent"
-	DefaultSystemPrompt      string  = "You are a versatile individual in a general field, and you need to assist clients in completing diverse tasks"
-	DefaultReActSystemPrompt string  = "You are a ReAct-style agent. Think step-by-step, decide when to call tools, and respond with final answers after tool use."
-	DefaultMaxCircle         int     = 5
-	DefaultTemperature       float32 = 0.5
+	DefaultName              string        = "Base_agent"
+	DefaultDescription       string        = "The basic for the extended intelligent agent"
+	DefaultSystemPrompt      string        = "You are a versatile individual in a general field, and you need to assist clients in completing diverse tasks"
+	DefaultReActSystemPrompt string        = "You are a ReAct-style agent. Think step-by-step, decide when to call tools, and respond with final answers after tool use."
+	DefaultMaxCircle         int           = 5
+	DefaultTemperature       float32       = 0.5
+	DefaultMaxParallelTools  int           = 4
+	DefaultToolTimeout       time.Duration = 60 * time.Second
+	DefaultStructuredRetries int           = 2
+	DefaultFinalAnswerPrompt string        = "Stop here and do not call any more tools. Using only the information gathered so far, give the best answer you can, and say clearly what is missing or uncertain."
 )
 
-type Message struct {
-	Role       string       `json:"role"`                   // 角色：system, user, assistant, tool
-	Content    string       `json:"content"`                // 消息内容
-	Name       string       `json:"name,omitempty"`         // Function/tool name (for tool role)
-	ToolCallID string       `json:"tool_call_id,omitempty"` // Tool call ID (for tool role)
-	ToolCalls  []tools.Tool `json:"tool_calls,omitempty"`   // Tool calls (for assistant role)
+// Message is the provider-neutral chat message exchanged with the model.
+type Message = llm.Message
+
+// ErrLoopLimit matches any *LoopLimitError with errors.Is.
+var ErrLoopLimit = errors.New("agent loop limit exceeded")
+
+// LoopLimitError is returned when the tool loop runs Maxcircle rounds
+// without a final answer. Transcript holds every message of the last
+// request, including the tool results gathered so far.
+type LoopLimitError struct {
+	Rounds     int
+	Transcript []Message
+	Usage      llm.Usage // spent by the invocation until it gave up
+	Cost       float64
+}
+
+func (e *LoopLimitError) Error() string {
+	return fmt.Sprintf("agent loop limit exceeded after %d rounds", e.Rounds)
+}
+
+func (e *LoopLimitError) Is(target error) bool {
+	return target == ErrLoopLimit
 }
 
 type Agent struct {
 	Name          string
 	Description   string
-	client        openai.Client
-	model         string
+	model         llm.ChatModel
 	tools         map[string]tools.Tool
-	apiTools      []openai.ChatCompletionToolParam
+	toolDefs      []llm.ToolDefinition
 	promptWrapper PromptWrapper
+	conversation  *Conversation
 	systemPrompt  string
-	Maxcircle     int
-	Temperature   float32
-	AllowTools    bool
+	// systemTemplate replaces systemPrompt when set.
+	systemTemplate *PromptTemplate
+	Maxcircle      int
+	Temperature    float32
+	AllowTools     bool
+
+	// ContextBudget caps the estimated prompt tokens per request. When 0 it
+	// is derived from the model's known context window.
+	ContextBudget int
+	// ContextPolicy shrinks the history once ContextBudget is exceeded;
+	// nil drops the oldest turns.
+	ContextPolicy ContextPolicy
+	// TokenEstimator overrides the per-model estimator.
+	TokenEstimator TokenEstimator
+
+	// MaxParallelTools bounds how many tool calls of one turn run at once.
+	MaxParallelTools int
+	// ToolTimeout is the default limit for a single tool call; tools can
+	// override it with tools.WithTimeout. 0 disables the limit.
+	ToolTimeout time.Duration
+	serialTools map[string]struct{}
+
+	middlewares     []tools.Middleware
+	toolMiddlewares map[string][]tools.Middleware
+
+	approver      Approver
+	approvalTools map[string]struct{}
+
+	// Prices estimates the cost of each completion by model.
+	Prices PriceTable
+	usage  usageCounter
+
+	// UnknownToolPolicy decides what happens when the model calls a tool
+	// that is not registered.
+	UnknownToolPolicy UnknownToolPolicy
+
+	// InvokeBudget limits every invocation and SessionBudget everything
+	// spent in one conversation. Zero fields are unlimited. The session's
+	// MaxDuration is wall-clock time since its first invocation, idle time
+	// between invocations included.
+	InvokeBudget  Budget
+	SessionBudget Budget
+	// BudgetFinalAnswer asks the model for a best-effort answer without
+	// tools when a budget runs out, instead of returning the error.
+	BudgetFinalAnswer bool
+	sharedBudget      *BudgetTracker
+
+	// Retry decides which failed completions are retried and how long to
+	// wait in between.
+	Retry llm.RetryPolicy
+
+	// ToolProtocol selects native tool calling (the default) or the
+	// text-based ReAct protocol for models without a tools API.
+	ToolProtocol ToolProtocol
+
+	// StructuredRetries bounds how often InvokeStructured re-prompts after
+	// a reply that does not match the schema.
+	StructuredRetries int
+
+	// FinalAnswerOnLimit makes one last call without tools when Maxcircle
+	// is reached, instead of returning a *LoopLimitError.
+	FinalAnswerOnLimit bool
+
+	// Reflection has a critic review draft answers; nil disables it.
+	Reflection *Reflection
+
+	// PromptVars are the default variables for prompt templates; the
+	// variables passed to InvokeWithVars take precedence.
+	PromptVars Vars
+
+	// MemoryStore holds long-term memories; the MemoryTopK most relevant
+	// to the query are put into the prompt of each invocation.
+	MemoryStore memory.Store
+	MemoryTopK  int
 }
 
-func NewAgent(apiKey string, baseURL string, model string, allow_tools bool) *Agent {
-	options := []option.RequestOption{option.WithAPIKey(apiKey)}
-	if baseURL != "" {
-		options = append(options, option.WithBaseURL(baseURL))
-	}
+// NewAgent creates an agent backed by the given chat model provider.
+func NewAgent(model llm.ChatModel, allow_tools bool) *Agent {
 	return &Agent{
 		Name:          DefaultName,
 		Description:   DefaultDescription,
-		client:        openai.NewClient(options...),
 		model:         model,
 		tools:         map[string]tools.Tool{},
-		apiTools:      []openai.ChatCompletionToolParam{},
+		toolDefs:      []llm.ToolDefinition{},
 		promptWrapper: DefaultPromptWrapper(),
+		conversation:  NewConversation(),
 		systemPrompt:  DefaultSystemPrompt,
 		Maxcircle:     DefaultMaxCircle,
 		Temperature:   DefaultTemperature,
 		AllowTools:    allow_tools,
+
+		MaxParallelTools: DefaultMaxParallelTools,
+		ToolTimeout:      DefaultToolTimeout,
+		serialTools:      map[string]struct{}{},
+		toolMiddlewares:  map[string][]tools.Middleware{},
+		approvalTools:    map[string]struct{}{},
+
+		UnknownToolPolicy: UnknownToolReport,
+		ToolProtocol:      ToolProtocolNative,
+		Retry:             llm.DefaultRetryPolicy(),
+		StructuredRetries: DefaultStructuredRetries,
 	}
 }
 
+// Model returns the chat model provider used by the agent.
+func (a *Agent) Model() llm.ChatModel {
+	return a.model
+}
+
 func (a *Agent) SetName(Name string) {
 	a.Name = Name
 }
@@ -72,12 +177,38 @@ func (a *Agent) SetDescription(Description string) {
 
 func (a *Agent) SetSystemPrompt(systemPrompt string) {
 	a.systemPrompt = systemPrompt
+	a.systemTemplate = nil
+}
+
+// SetSystemTemplate replaces the system prompt with a template rendered
+// on every call, e.g. one from LoadPromptDir.
+func (a *Agent) SetSystemTemplate(t *PromptTemplate) {
+	a.systemTemplate = t
 }
 
 func (a *Agent) SetPromptWrapper(wrapper PromptWrapper) {
 	a.promptWrapper = wrapper
 }
 
+// Conversation returns the transcript used by Invoke.
+func (a *Agent) Conversation() *Conversation {
+	return a.conversation
+}
+
+// SetConversation replaces the transcript used by Invoke, e.g. to resume a
+// stored session or continue from a fork.
+func (a *Agent) SetConversation(conv *Conversation) {
+	if conv == nil {
+		conv = NewConversation()
+	}
+	a.conversation = conv
+}
+
+// ResetConversation clears the transcript used by Invoke.
+func (a *Agent) ResetConversation() {
+	a.conversation.Reset()
+}
+
 func (a *Agent) AddSystemPrompt(prompt string) {
 	a.promptWrapper.AddSystemPrompt(prompt)
 }
@@ -86,14 +217,20 @@ func (a *Agent) AddUserPrompt(prompt string) {
 	a.promptWrapper.AddUserPrompt(prompt)
 }
 
-func (a *Agent) AddMemory(memory string) {
-	a.promptWrapper.AddMemory(memory)
-}
-
 func (a *Agent) AddToolUsage(toolUsage string) {
 	a.promptWrapper.AddToolUsage(toolUsage)
 }
 
+// AddExamples adds few-shot examples sent with every request.
+func (a *Agent) AddExamples(examples ...FewShotExample) {
+	a.promptWrapper.AddExamples(examples...)
+}
+
+// SetExampleSelector picks few-shot examples per query.
+func (a *Agent) SetExampleSelector(selector ExampleSelector) {
+	a.promptWrapper.SetExampleSelector(selector)
+}
+
 // 注册工具
 func (a *Agent) ListTools() []tools.Tool {
 	items := make([]tools.Tool, 0, len(a.tools))
@@ -111,17 +248,10 @@ func (a *Agent) RegisterTool(tool tools.Tool) {
 		tool.Kind = tools.ToolKindTool
 	}
 	a.tools[tool.Name] = tool
-	functionDef := openai.FunctionDefinitionParam{
-		Name: tool.Name,
-	}
-	if tool.Description != "" {
-		functionDef.Description = openai.String(tool.Description)
-	}
-	if tool.Parameters != nil {
-		functionDef.Parameters = openai.FunctionParameters(tool.Parameters)
-	}
-	a.apiTools = append(a.apiTools, openai.ChatCompletionToolParam{
-		Function: functionDef,
+	a.toolDefs = append(a.toolDefs, llm.ToolDefinition{
+		Name:        tool.Name,
+		Description: tool.Description,
+		Parameters:  tool.Parameters,
 	})
 }
 
@@ -129,50 +259,355 @@ func (a *Agent) RegisterToolFunc(name string, handler tools.ToolHandler, opts ..
 	a.RegisterTool(tools.New(name, handler, opts...))
 }
 
+// Invoke answers userQuery within the agent's own conversation.
 func (a *Agent) Invoke(ctx context.Context, userQuery string) (string, error) {
+	result, err := a.run(ctx, a.conversation, userQuery, callOptions{}, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// InvokeWithResult is Invoke returning the answer together with its token
+// usage and estimated cost.
+func (a *Agent) InvokeWithResult(ctx context.Context, userQuery string) (*InvokeResult, error) {
+	return a.run(ctx, a.conversation, userQuery, callOptions{}, nil)
+}
+
+// InvokeWithAttachments is InvokeWithResult with images or files sent
+// along with userQuery, e.g. parts from llm.PartFromPath.
+func (a *Agent) InvokeWithAttachments(ctx context.Context, userQuery string, attachments ...llm.ContentPart) (*InvokeResult, error) {
+	return a.run(ctx, a.conversation, userQuery, callOptions{attachments: attachments}, nil)
+}
+
+// InvokeWithVars is InvokeWithResult with variables for the prompt
+// templates of this call.
+func (a *Agent) InvokeWithVars(ctx context.Context, userQuery string, vars Vars) (*InvokeResult, error) {
+	return a.run(ctx, a.conversation, userQuery, callOptions{vars: vars}, nil)
+}
+
+// InvokeConversation answers userQuery within conv instead of the agent's
+// own conversation, so one agent can serve several sessions.
+func (a *Agent) InvokeConversation(ctx context.Context, conv *Conversation, userQuery string) (*InvokeResult, error) {
+	return a.run(ctx, conv, userQuery, callOptions{}, nil)
+}
+
+// promptVars merges the agent's PromptVars with the variables of a call.
+func (a *Agent) promptVars(vars Vars) Vars {
+	if len(a.PromptVars) == 0 {
+		return vars
+	}
+	merged := make(Vars, len(a.PromptVars)+len(vars))
+	for k, v := range a.PromptVars {
+		merged[k] = v
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	return merged
+}
+
+// callOptions are per-call settings passed to run.
+type callOptions struct {
+	responseFormat *llm.ResponseFormat
+	attachments    []llm.ContentPart // sent with the user message
+	vars           Vars              // prompt template variables
+}
+
+// run drives the tool loop shared by Invoke and InvokeStream. A nil sink
+// means the completion is requested in one piece. On success the messages
+// of this turn are appended to conv. Usage is rolled up into the agent and
+// conv totals even when the invocation fails.
+func (a *Agent) run(ctx context.Context, conv *Conversation, userQuery string, opts callOptions, sink eventSink) (*InvokeResult, error) {
+	result := &InvokeResult{}
+	defer a.recordUsage(conv, result)
 	wrapper := a.promptWrapper
-	wrapper.AddSystemPrompt(a.systemPrompt)
+	if a.systemTemplate != nil {
+		wrapper.AddSystemTemplate(a.systemTemplate)
+	} else {
+		wrapper.AddSystemPrompt(a.systemPrompt)
+	}
 	wrapper.AddUserPrompt(userQuery)
-	messages := wrapper.WrapMessages(a.Name, a.Description)
+	result.Memories = a.recall(ctx, &wrapper, userQuery)
+	react := a.usesReActText()
+	if react {
+		wrapper.AddToolUsage(a.reactToolPrompt())
+	}
+	messages := make([]Message, 0, conv.Len()+2)
+	system, ok, err := wrapper.RenderSystemMessage(a.Name, a.Description, a.promptVars(opts.vars))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		messages = append(messages, system)
+	}
+	examples, err := wrapper.ExampleMessages(ctx, userQuery)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, examples...)
+	prefix := len(messages)
+	messages = append(messages, conv.Messages()...)
+	turnStart := len(messages)
+	if msg, ok := wrapper.UserMessage(); ok {
+		msg.Parts = opts.attachments
+		messages = append(messages, msg)
+	}
+	compacted := false
+	// finish records the turn, or the whole compacted history when the
+	// context policy rewrote earlier messages.
+	finish := func() {
+		if compacted {
+			conv.Replace(messages[prefix:])
+			return
+		}
+		conv.Append(messages[turnStart:]...)
+	}
+	budget := a.budgetsFor(conv)
+	// MaxDuration also cancels the model and tool calls in flight.
+	parent := ctx
+	if deadline, ok := budget.deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	round := 0 // last model round started
+	// stop ends the loop early because of cause. With finalAnswer the model
+	// answers once more without tools and the result is marked partial.
+	stop := func(cause error, finalAnswer bool) (*InvokeResult, error) {
+		if !finalAnswer {
+			return nil, cause
+		}
+		answerCtx := ctx
+		if errors.Is(cause, ErrBudgetExceeded) {
+			// The answer is written past the budget, deadline included.
+			answerCtx = parent
+		}
+		msg, err := a.finalAnswer(answerCtx, messages, prefix, round+1, result, budget, sink)
+		if err != nil {
+			return nil, fmt.Errorf("%w (final answer failed: %v)", cause, err)
+		}
+		messages = append(messages, msg)
+		finish()
+		result.Content = msg.Content
+		result.Partial = true
+		result.StopReason = cause
+		return result, nil
+	}
+	// failed returns err, or the budget error when err was caused by the
+	// MaxDuration deadline.
+	failed := func(err error) (*InvokeResult, error) {
+		if ctx.Err() != nil && parent.Err() == nil {
+			if limit := budget.check(); limit != nil {
+				return stop(limit, a.BudgetFinalAnswer)
+			}
+		}
+		return nil, err
+	}
+	reflections := 0
+	// revise has the critic review draft, the last message, and asks for a
+	// revision when it is rejected. It reports whether the loop goes on.
+	// A draft written in the last round is kept: no round is left to
+	// revise it.
+	revise := func(draft Message) bool {
+		if a.Reflection == nil || reflections >= a.Reflection.maxRounds() || round >= a.Maxcircle {
+			return false
+		}
+		start := turnStart
+		if compacted {
+			start = prefix
+		}
+		verdict, step := a.review(ctx, round, userQuery, messages[start:len(messages)-1], draft.Content, result, budget)
+		result.Trace = append(result.Trace, step)
+		if verdict.Approved {
+			return false
+		}
+		reflections++
+		messages = append(messages, revisionRequest(verdict))
+		return true
+	}
 	for i := 1; i <= a.Maxcircle; i++ {
-		req := openai.ChatCompletionNewParams{
-			Model:    a.model,
-			Messages: messages,
+		if err := budget.check(); err != nil {
+			return stop(err, a.BudgetFinalAnswer)
+		}
+		round = i
+		req := llm.Request{
+			Temperature:    a.Temperature,
+			ResponseFormat: opts.responseFormat,
+		}
+		if a.AllowTools && len(a.toolDefs) > 0 && !react {
+			req.Tools = a.toolDefs
+		}
+		fitted, changed, err := a.fitContext(ctx, messages, prefix, req.Tools, result, budget)
+		if err != nil {
+			return failed(err)
+		}
+		if changed {
+			messages = fitted
+			compacted = true
+		}
+		req.Messages = messages
+		if react {
+			req.Messages = renderReActMessages(messages)
+			req.Stop = reactStop
 		}
-		req.Temperature = openai.Float(float64(a.Temperature))
-		if a.AllowTools && len(a.apiTools) > 0 {
-			req.Tools = a.apiTools
+		// With a critic the text may be a draft it rejects, so it is only
+		// streamed once it is kept.
+		var draft deltaBuffer
+		roundSink := sink
+		switch {
+		case react:
+			roundSink = asReasoning(sink)
+		case a.Reflection != nil:
+			roundSink = draft.wrap(sink)
 		}
-		resp, err := a.client.Chat.Completions.New(ctx, req)
+		start := time.Now()
+		resp, err := a.complete(ctx, req, roundSink)
 		if err != nil {
-			return "", fmt.Errorf("llm error: %v", err)
+			return failed(err)
 		}
-		msg := resp.Choices[0].Message
-		messages = append(messages, msg.ToParam())
+		budget.addUsage(resp.Usage, a.addRound(result, resp))
+		msg := resp.Message
+		step := roundTrace(i, msg.Content, resp, time.Since(start))
+		if react {
+			parsed, thought, err := a.parseReActMessage(msg, i)
+			if err != nil {
+				reminder := reactFormatReminder(err)
+				step.Observation = reminder.Content
+				result.Trace = append(result.Trace, step)
+				messages = append(messages, msg, reminder)
+				continue
+			}
+			msg, step.Thought = parsed, thought
+		}
+		messages = append(messages, msg)
 		if !a.AllowTools {
 			if len(msg.ToolCalls) > 0 {
-				return "", fmt.Errorf("tool calls disabled but received %d tool calls", len(msg.ToolCalls))
+				return nil, fmt.Errorf("tool calls disabled but received %d tool calls", len(msg.ToolCalls))
 			}
-			return msg.Content, nil
+			result.Trace = append(result.Trace, finalStep(step, react))
+			if revise(msg) {
+				continue
+			}
+			draft.flush(sink)
+			if react {
+				sink.send(StreamEvent{Type: StreamEventTextDelta, Delta: msg.Content})
+			}
+			finish()
+			result.Content = msg.Content
+			return result, nil
 		}
 		if len(msg.ToolCalls) == 0 {
-			return msg.Content, nil
-		}
-		for _, toolCall := range msg.ToolCalls {
-			toolName := toolCall.Function.Name
-			args := toolCall.Function.Arguments
-			tool, exists := a.tools[toolName]
-			if !exists {
-				log.Printf("Tool %s not found", toolName)
+			result.Trace = append(result.Trace, finalStep(step, react))
+			if revise(msg) {
 				continue
 			}
-			log.Printf("Agent calling tool: %s with args: %s", toolName, args)
-			result, err := tool.Handler(ctx, args)
-			if err != nil {
-				result = fmt.Sprintf("Error executing tool: %v", err)
+			draft.flush(sink)
+			if react {
+				sink.send(StreamEvent{Type: StreamEventTextDelta, Delta: msg.Content})
 			}
-			messages = append(messages, openai.ToolMessage(result, toolCall.ID))
+			finish()
+			result.Content = msg.Content
+			return result, nil
 		}
+		draft.flush(sink)
+		if err := budget.check(); err != nil {
+			skipped := skippedToolResults(msg.ToolCalls, err)
+			result.Trace = append(result.Trace, toolSteps(step, msg.ToolCalls, skipped, make([]time.Duration, len(skipped)))...)
+			messages = append(messages, skipped...)
+			return stop(err, a.BudgetFinalAnswer)
+		}
+		if err := budget.reserveToolCalls(len(msg.ToolCalls)); err != nil {
+			skipped := skippedToolResults(msg.ToolCalls, err)
+			result.Trace = append(result.Trace, toolSteps(step, msg.ToolCalls, skipped, make([]time.Duration, len(skipped)))...)
+			messages = append(messages, skipped...)
+			return stop(err, a.BudgetFinalAnswer)
+		}
+		toolMessages, latencies, err := a.executeToolCalls(ctx, msg.ToolCalls, sink)
+		if err != nil {
+			return nil, err
+		}
+		result.Trace = append(result.Trace, toolSteps(step, msg.ToolCalls, toolMessages, latencies)...)
+		messages = append(messages, withToolAttachments(toolMessages)...)
+	}
+	return stop(&LoopLimitError{
+		Rounds:     a.Maxcircle,
+		Transcript: append([]Message(nil), messages...),
+		Usage:      result.Usage,
+		Cost:       result.Cost,
+	}, a.FinalAnswerOnLimit)
+}
+
+// complete requests one chat completion, streaming text deltas to sink when
+// it is non-nil. Failures are retried according to a.Retry, except once
+// deltas have been streamed.
+func (a *Agent) complete(ctx context.Context, req llm.Request, sink eventSink) (*llm.Response, error) {
+	return a.completeWith(ctx, a.model, req, sink)
+}
+
+// completeWith is complete on another model, e.g. the reflection critic.
+func (a *Agent) completeWith(ctx context.Context, model llm.ChatModel, req llm.Request, sink eventSink) (*llm.Response, error) {
+	for attempt := 1; ; attempt++ {
+		var resp *llm.Response
+		var err error
+		streamed := false
+		if sink == nil {
+			resp, err = model.Chat(ctx, req)
+		} else {
+			resp, err = model.ChatStream(ctx, req, func(d llm.Delta) {
+				streamed = true
+				sink.send(StreamEvent{Type: StreamEventTextDelta, Delta: d.Content})
+			})
+		}
+		if err == nil {
+			return resp, nil
+		}
+		delay, retry := a.Retry.Delay(attempt, err)
+		if !retry || streamed {
+			return nil, fmt.Errorf("llm error: %w", err)
+		}
+		log.Printf("llm error (attempt %d/%d), retrying in %v: %v", attempt, a.Retry.MaxAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("llm error: %w", err)
+		}
+	}
+}
+
+// finalAnswer asks the model to answer from messages without offering any
+// tools. The instruction is sent but not kept in the transcript.
+func (a *Agent) finalAnswer(ctx context.Context, messages []Message, prefix, round int, result *InvokeResult, budget budgets, sink eventSink) (Message, error) {
+	prompt := append(messages[:len(messages):len(messages)], Message{Role: llm.RoleUser, Content: DefaultFinalAnswerPrompt, Synthetic: true})
+	fitted, _, err := a.fitContext(ctx, prompt, prefix, nil, result, budget)
+	if err != nil {
+		return Message{}, err
+	}
+	react := a.usesReActText()
+	if react {
+		fitted = renderReActMessages(fitted)
+	}
+	answerSink := sink
+	if react {
+		answerSink = asReasoning(sink)
+	}
+	start := time.Now()
+	resp, err := a.complete(ctx, llm.Request{Messages: fitted, Temperature: a.Temperature}, answerSink)
+	if err != nil {
+		return Message{}, err
+	}
+	budget.addUsage(resp.Usage, a.addRound(result, resp))
+	msg := resp.Message
+	msg.ToolCalls = nil
+	step := roundTrace(round, "", resp, time.Since(start))
+	step.Final = true
+	if parsed, err := ParseReActOutput(msg.Content); react && err == nil && parsed.Final {
+		msg.Content = parsed.FinalAnswer
+		step.Thought = parsed.Thought
+	}
+	if react {
+		sink.send(StreamEvent{Type: StreamEventTextDelta, Delta: msg.Content})
 	}
-	return "", fmt.Errorf("agent loop limit exceeded")
+	result.Trace = append(result.Trace, step)
+	return msg, nil
 }
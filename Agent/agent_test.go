@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+// fakeChatModel replays scripted responses and records every request.
+type fakeChatModel struct {
+	mu        sync.Mutex
+	responses []llm.Response
+	failures  []error // returned, in order, before any response
+	requests  []llm.Request
+}
+
+func newFakeChatModel(responses ...llm.Response) *fakeChatModel {
+	return &fakeChatModel{responses: responses}
+}
+
+func (m *fakeChatModel) Chat(_ context.Context, req llm.Request) (*llm.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, req)
+	if len(m.failures) > 0 {
+		err := m.failures[0]
+		m.failures = m.failures[1:]
+		return nil, err
+	}
+	if len(m.responses) == 0 {
+		return nil, fmt.Errorf("fake model: no scripted response left")
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return &resp, nil
+}
+
+func (m *fakeChatModel) ChatStream(ctx context.Context, req llm.Request, onDelta llm.StreamFunc) (*llm.Response, error) {
+	resp, err := m.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resp.Message.Content {
+		if onDelta != nil {
+			onDelta(llm.Delta{Content: string(r)})
+		}
+	}
+	return resp, nil
+}
+
+func (m *fakeChatModel) ModelName() string {
+	return "fake-model"
+}
+
+func (m *fakeChatModel) Requests() []llm.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]llm.Request(nil), m.requests...)
+}
+
+func textResponse(content string) llm.Response {
+	return llm.Response{Message: llm.Message{Role: llm.RoleAssistant, Content: content}}
+}
+
+func toolCallResponse(calls ...llm.ToolCall) llm.Response {
+	return llm.Response{Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: calls}}
+}
+
+func echoTool(name string) tools.Tool {
+	return tools.New(name, func(_ context.Context, args string) (string, error) {
+		return name + ":" + args, nil
+	})
+}
+
+func TestInvokeRunsToolLoop(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{"x":1}`}),
+		textResponse("done"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+
+	reply, err := a.Invoke(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if reply != "done" {
+		t.Fatalf("reply = %q, want %q", reply, "done")
+	}
+	reqs := model.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if len(reqs[0].Tools) != 1 || reqs[0].Tools[0].Name != "echo" {
+		t.Fatalf("tools not sent to model: %+v", reqs[0].Tools)
+	}
+	last := reqs[1].Messages[len(reqs[1].Messages)-1]
+	if last.Role != llm.RoleTool || last.ToolCallID != "call_1" || last.Content != `echo:{"x":1}` {
+		t.Fatalf("unexpected tool message: %+v", last)
+	}
+}
+
+func TestInvokeStreamEmitsEvents(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`}),
+		textResponse("ok"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+
+	var text string
+	var types []StreamEventType
+	for ev := range a.InvokeStream(context.Background(), "hi") {
+		if ev.Type == StreamEventTextDelta {
+			text += ev.Delta
+			continue
+		}
+		types = append(types, ev.Type)
+	}
+	want := []StreamEventType{StreamEventToolCall, StreamEventToolResult, StreamEventFinal}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	if text != "ok" {
+		t.Fatalf("streamed text = %q, want %q", text, "ok")
+	}
+}
+
+func TestInvokeReplaysConversation(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`}),
+		textResponse("first"),
+		textResponse("second"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+
+	if _, err := a.Invoke(context.Background(), "one"); err != nil {
+		t.Fatalf("Invoke one: %v", err)
+	}
+	fork := a.Conversation().Fork()
+	if _, err := a.Invoke(context.Background(), "two"); err != nil {
+		t.Fatalf("Invoke two: %v", err)
+	}
+
+	var roles []string
+	reqs := model.Requests()
+	for _, msg := range reqs[len(reqs)-1].Messages {
+		roles = append(roles, msg.Role)
+	}
+	want := []string{"system", "user", "assistant", "tool", "assistant", "user"}
+	if fmt.Sprint(roles) != fmt.Sprint(want) {
+		t.Fatalf("replayed roles = %v, want %v", roles, want)
+	}
+	if got := a.Conversation().Len(); got != 6 {
+		t.Fatalf("conversation length = %d, want 6", got)
+	}
+	if got := fork.Len(); got != 4 {
+		t.Fatalf("fork length = %d, want 4", got)
+	}
+	a.ResetConversation()
+	if got := a.Conversation().Len(); got != 0 {
+		t.Fatalf("conversation length after reset = %d, want 0", got)
+	}
+}
+
+func TestInvokeWithResultSumsUsage(t *testing.T) {
+	first := toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`})
+	first.Usage = llm.Usage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100, CachedTokens: 400}
+	second := textResponse("done")
+	second.Usage = llm.Usage{PromptTokens: 2000, CompletionTokens: 200, TotalTokens: 2200}
+	second.Model = "priced-model-2024"
+	a := NewAgent(newFakeChatModel(first, second), true)
+	a.RegisterTool(echoTool("echo"))
+	a.Prices = PriceTable{
+		"fake-model":   {Input: 1, CachedInput: 0.5, Output: 2},
+		"priced-model": {Input: 10, Output: 20},
+	}
+
+	result, err := a.InvokeWithResult(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	want := llm.Usage{PromptTokens: 3000, CompletionTokens: 300, TotalTokens: 3300, CachedTokens: 400}
+	if result.Usage != want {
+		t.Fatalf("usage = %+v, want %+v", result.Usage, want)
+	}
+	// round 1: 600*1 + 400*0.5 + 100*2 = 1000; round 2: 2000*10 + 200*20 = 24000
+	if wantCost := 25000 / 1e6; result.Cost != wantCost {
+		t.Fatalf("cost = %v, want %v", result.Cost, wantCost)
+	}
+	if result.Model != "priced-model-2024" {
+		t.Fatalf("model = %q, want the model that answered last", result.Model)
+	}
+	if got := a.Usage(); got.Invocations != 1 || got.Usage != want {
+		t.Fatalf("agent totals = %+v", got)
+	}
+	if got := a.Conversation().Usage(); got.Cost != result.Cost {
+		t.Fatalf("session cost = %v, want %v", got.Cost, result.Cost)
+	}
+}
+
+func TestInvokeLoopLimit(t *testing.T) {
+	call := toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`})
+	newAgent := func(responses ...llm.Response) *Agent {
+		a := NewAgent(newFakeChatModel(responses...), true)
+		a.RegisterTool(echoTool("echo"))
+		a.Maxcircle = 2
+		return a
+	}
+
+	_, err := newAgent(call, call).Invoke(context.Background(), "hi")
+	var limitErr *LoopLimitError
+	if !errors.Is(err, ErrLoopLimit) || !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v, want *LoopLimitError", err)
+	}
+	last := limitErr.Transcript[len(limitErr.Transcript)-1]
+	if last.Role != llm.RoleTool || last.Content != "echo:{}" {
+		t.Fatalf("transcript does not end with the tool result: %+v", last)
+	}
+
+	a := newAgent(call, call, textResponse("partial"))
+	a.FinalAnswerOnLimit = true
+	result, err := a.InvokeWithResult(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	if !result.Partial || result.Content != "partial" || !errors.Is(result.StopReason, ErrLoopLimit) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestInvokeRetriesRetryableErrors(t *testing.T) {
+	rateLimited := &llm.Error{Kind: llm.ErrorRateLimit, StatusCode: 429, Err: errors.New("slow down")}
+	model := newFakeChatModel(textResponse("ok"))
+	model.failures = []error{rateLimited, rateLimited}
+	a := NewAgent(model, false)
+	a.Retry = llm.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	reply, err := a.Invoke(context.Background(), "hi")
+	if err != nil || reply != "ok" {
+		t.Fatalf("Invoke = %q, %v; want ok", reply, err)
+	}
+
+	auth := &llm.Error{Kind: llm.ErrorAuth, StatusCode: 401, Err: errors.New("bad key")}
+	model = newFakeChatModel(textResponse("never"))
+	model.failures = []error{auth}
+	a = NewAgent(model, false)
+	a.Retry = llm.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	if _, err := a.Invoke(context.Background(), "hi"); !errors.Is(err, llm.ErrAuth) {
+		t.Fatalf("err = %v, want llm.ErrAuth", err)
+	}
+	if got := len(model.Requests()); got != 1 {
+		t.Fatalf("auth error was retried: %d requests", got)
+	}
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"agent/tools"
+)
+
+type ApprovalAction string
+
+const (
+	ApprovalApprove ApprovalAction = "approve"
+	ApprovalDeny    ApprovalAction = "deny"
+	ApprovalEdit    ApprovalAction = "edit"
+)
+
+// ApprovalRequest describes a tool call waiting for confirmation.
+type ApprovalRequest struct {
+	ToolName  string
+	CallID    string
+	Arguments string
+}
+
+// ApprovalDecision is the answer to an ApprovalRequest. Reason is sent back
+// to the model on deny; Arguments replaces the call arguments on edit.
+type ApprovalDecision struct {
+	Action    ApprovalAction
+	Reason    string
+	Arguments string
+}
+
+// Approver decides whether a sensitive tool call may run.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+// ApproverFunc adapts a function to the Approver interface.
+type ApproverFunc func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	return f(ctx, req)
+}
+
+// SetApprover sets the approver consulted before tools that require approval.
+func (a *Agent) SetApprover(approver Approver) {
+	a.approver = approver
+}
+
+// RequireApproval marks tools of this agent as requiring approval, in
+// addition to tools registered with tools.WithApproval.
+func (a *Agent) RequireApproval(names ...string) {
+	for _, name := range names {
+		a.approvalTools[name] = struct{}{}
+	}
+}
+
+func (a *Agent) requiresApproval(tool tools.Tool) bool {
+	if tool.RequiresApproval {
+		return true
+	}
+	_, ok := a.approvalTools[tool.Name]
+	return ok
+}
+
+// approve consults the approver. Without an approver, or when it fails, the
+// call is denied.
+func (a *Agent) approve(ctx context.Context, req ApprovalRequest) ApprovalDecision {
+	if a.approver == nil {
+		return ApprovalDecision{Action: ApprovalDeny, Reason: "no approver is configured for this tool"}
+	}
+	decision, err := a.approver.Approve(ctx, req)
+	if err != nil {
+		return ApprovalDecision{Action: ApprovalDeny, Reason: fmt.Sprintf("approval failed: %v", err)}
+	}
+	if decision.Action == ApprovalDeny && decision.Reason == "" {
+		decision.Reason = "the user declined this call"
+	}
+	return decision
+}
+
+// TerminalApprover prompts on a terminal for every sensitive tool call.
+// Prompts are serialized, so parallel tool calls ask one at a time.
+type TerminalApprover struct {
+	mu  sync.Mutex
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// NewTerminalApprover reads answers from in, which may be shared with the
+// caller's REPL since the agent only prompts while an invocation runs.
+func NewTerminalApprover(in *bufio.Scanner, out io.Writer) *TerminalApprover {
+	return &TerminalApprover{in: in, out: out}
+}
+
+func (t *TerminalApprover) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return ApprovalDecision{}, err
+	}
+	fmt.Fprintf(t.out, "Allow %s(%s)? [y/N/e] ", req.ToolName, req.Arguments)
+	answer, err := t.readLine()
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return ApprovalDecision{Action: ApprovalApprove}, nil
+	case "e", "edit":
+		fmt.Fprint(t.out, "New arguments> ")
+		args, err := t.readLine()
+		if err != nil {
+			return ApprovalDecision{}, err
+		}
+		if args == "" {
+			args = req.Arguments
+		}
+		return ApprovalDecision{Action: ApprovalEdit, Arguments: args}, nil
+	default:
+		fmt.Fprint(t.out, "Reason (optional)> ")
+		reason, err := t.readLine()
+		if err != nil {
+			return ApprovalDecision{}, err
+		}
+		return ApprovalDecision{Action: ApprovalDeny, Reason: reason}, nil
+	}
+}
+
+func (t *TerminalApprover) readLine() (string, error) {
+	if !t.in.Scan() {
+		if err := t.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSpace(t.in.Text()), nil
+}
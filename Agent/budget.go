@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"agent/llm"
+)
+
+// Budget limits spend. Zero fields are unlimited. MaxDuration is wall-clock
+// time from the tracker's first use: the start of the invocation, the first
+// invocation of a session, or the first invocation under a shared budget.
+// Idle time between invocations counts too. MaxDuration also cancels the
+// model and tool calls still running when it passes.
+type Budget struct {
+	MaxTokens    int64         `mapstructure:"max_tokens"`
+	MaxCost      float64       `mapstructure:"max_cost"`
+	MaxDuration  time.Duration `mapstructure:"max_duration"`
+	MaxToolCalls int           `mapstructure:"max_tool_calls"`
+}
+
+// IsZero reports whether the budget has no limits.
+func (b Budget) IsZero() bool {
+	return b == Budget{}
+}
+
+type BudgetLimit string
+
+const (
+	BudgetLimitTokens    BudgetLimit = "tokens"
+	BudgetLimitCost      BudgetLimit = "cost"
+	BudgetLimitDuration  BudgetLimit = "duration"
+	BudgetLimitToolCalls BudgetLimit = "tool_calls"
+)
+
+// ErrBudgetExceeded matches any *BudgetExceededError with errors.Is.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// BudgetExceededError reports which budget ran out.
+type BudgetExceededError struct {
+	Scope string // invocation, session or shared
+	Limit BudgetLimit
+	Used  string
+	Max   string
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s budget exceeded: %s %s of %s", e.Scope, e.Limit, e.Used, e.Max)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// BudgetSpend is what a tracker has counted so far.
+type BudgetSpend struct {
+	Tokens    int64
+	Cost      float64
+	ToolCalls int
+	Elapsed   time.Duration
+}
+
+// BudgetTracker counts spend against a Budget. It is safe for concurrent
+// use, so one tracker can be shared by several agents.
+type BudgetTracker struct {
+	mu        sync.Mutex
+	scope     string
+	budget    Budget
+	start     time.Time
+	tokens    int64
+	cost      float64
+	toolCalls int
+}
+
+// NewBudgetTracker creates a shared tracker for budget.
+func NewBudgetTracker(budget Budget) *BudgetTracker {
+	return newBudgetTracker("shared", budget)
+}
+
+func newBudgetTracker(scope string, budget Budget) *BudgetTracker {
+	return &BudgetTracker{scope: scope, budget: budget}
+}
+
+// SetBudget changes the limits without resetting the spend.
+func (t *BudgetTracker) SetBudget(budget Budget) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.budget = budget
+}
+
+// Spent returns the spend counted so far.
+func (t *BudgetTracker) Spent() BudgetSpend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spend := BudgetSpend{Tokens: t.tokens, Cost: t.cost, ToolCalls: t.toolCalls}
+	if !t.start.IsZero() {
+		spend.Elapsed = time.Since(t.start)
+	}
+	return spend
+}
+
+func (t *BudgetTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+}
+
+func (t *BudgetTracker) addUsage(usage llm.Usage, cost float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens += usage.TotalTokens
+	t.cost += cost
+}
+
+// reserveToolCalls counts n tool calls, or reports the exceeded limit and
+// counts nothing when they would not fit.
+func (t *BudgetTracker) reserveToolCalls(n int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.budget.MaxToolCalls > 0 && t.toolCalls+n > t.budget.MaxToolCalls {
+		return &BudgetExceededError{
+			Scope: t.scope,
+			Limit: BudgetLimitToolCalls,
+			Used:  fmt.Sprint(t.toolCalls + n),
+			Max:   fmt.Sprint(t.budget.MaxToolCalls),
+		}
+	}
+	t.toolCalls += n
+	return nil
+}
+
+// deadline returns when MaxDuration runs out, if it is set.
+func (t *BudgetTracker) deadline() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.budget.MaxDuration <= 0 || t.start.IsZero() {
+		return time.Time{}, false
+	}
+	return t.start.Add(t.budget.MaxDuration), true
+}
+
+// check reports the first token, cost or duration limit that is used up.
+func (t *BudgetTracker) check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.budget
+	switch {
+	case b.MaxTokens > 0 && t.tokens >= b.MaxTokens:
+		return &BudgetExceededError{Scope: t.scope, Limit: BudgetLimitTokens, Used: fmt.Sprint(t.tokens), Max: fmt.Sprint(b.MaxTokens)}
+	case b.MaxCost > 0 && t.cost >= b.MaxCost:
+		return &BudgetExceededError{Scope: t.scope, Limit: BudgetLimitCost, Used: fmt.Sprintf("%.6f", t.cost), Max: fmt.Sprintf("%.6f", b.MaxCost)}
+	case b.MaxDuration > 0 && !t.start.IsZero() && time.Since(t.start) >= b.MaxDuration:
+		return &BudgetExceededError{Scope: t.scope, Limit: BudgetLimitDuration, Used: time.Since(t.start).Round(time.Millisecond).String(), Max: b.MaxDuration.String()}
+	}
+	return nil
+}
+
+// SetSharedBudget makes the agent count its spend against tracker as well,
+// e.g. one budget shared by every node of a NetAgent. nil detaches it.
+func (a *Agent) SetSharedBudget(tracker *BudgetTracker) {
+	a.sharedBudget = tracker
+}
+
+// budgets lists the trackers that apply to one invocation in conv.
+type budgets []*BudgetTracker
+
+func (a *Agent) budgetsFor(conv *Conversation) budgets {
+	if conv.parent == nil {
+		conv.sessionBudget().SetBudget(a.SessionBudget)
+	}
+	list := budgets{newBudgetTracker("invocation", a.InvokeBudget), conv.sessionBudget()}
+	if a.sharedBudget != nil {
+		list = append(list, a.sharedBudget)
+	}
+	for _, t := range list {
+		t.begin()
+	}
+	return list
+}
+
+func (b budgets) addUsage(usage llm.Usage, cost float64) {
+	for _, t := range b {
+		t.addUsage(usage, cost)
+	}
+}
+
+// deadline returns the earliest MaxDuration deadline of the trackers.
+func (b budgets) deadline() (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for _, t := range b {
+		if d, ok := t.deadline(); ok && (!found || d.Before(earliest)) {
+			earliest, found = d, true
+		}
+	}
+	return earliest, found
+}
+
+func (b budgets) check() error {
+	for _, t := range b {
+		if err := t.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveToolCalls reserves n calls in every tracker, or none of them.
+func (b budgets) reserveToolCalls(n int) error {
+	for i, t := range b {
+		if err := t.reserveToolCalls(n); err != nil {
+			for _, prev := range b[:i] {
+				prev.reserveToolCalls(-n)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// skippedToolResults answers tool calls that were not run, so the
+// transcript stays valid for the provider.
+func skippedToolResults(calls []llm.ToolCall, cause error) []Message {
+	out := make([]Message, 0, len(calls))
+	for _, call := range calls {
+		out = append(out, Message{
+			Role:       llm.RoleTool,
+			ToolCallID: call.ID,
+			Name:       call.Name,
+			Content:    fmt.Sprintf("Tool %s was not run: %v", call.Name, cause),
+		})
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"agent/llm"
+)
+
+func TestInvokeStopsWhenToolCallBudgetRunsOut(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`}),
+		toolCallResponse(llm.ToolCall{ID: "call_2", Name: "echo", Arguments: `{}`}),
+		textResponse("never"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+	a.InvokeBudget = Budget{MaxToolCalls: 1}
+
+	_, err := a.Invoke(context.Background(), "hi")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want ErrBudgetExceeded", err)
+	}
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Scope != "invocation" || budgetErr.Limit != BudgetLimitToolCalls {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	if got := len(model.Requests()); got != 2 {
+		t.Fatalf("got %d requests, want 2", got)
+	}
+}
+
+func TestInvokeBudgetFinalAnswer(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`}),
+		toolCallResponse(llm.ToolCall{ID: "call_2", Name: "echo", Arguments: `{}`}),
+		textResponse("best effort"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+	a.InvokeBudget = Budget{MaxToolCalls: 1}
+	a.BudgetFinalAnswer = true
+
+	result, err := a.InvokeWithResult(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	if !result.Partial || result.Content != "best effort" || !errors.Is(result.StopReason, ErrBudgetExceeded) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	reqs := model.Requests()
+	final := reqs[len(reqs)-1]
+	if len(final.Tools) != 0 {
+		t.Fatalf("final answer request offered tools: %+v", final.Tools)
+	}
+	skipped := final.Messages[len(final.Messages)-2]
+	if skipped.Role != llm.RoleTool || skipped.ToolCallID != "call_2" {
+		t.Fatalf("skipped call not answered: %+v", skipped)
+	}
+	// The final-answer instruction is not kept in the conversation.
+	msgs := a.Conversation().Messages()
+	if last := msgs[len(msgs)-1]; last.Content != "best effort" || msgs[len(msgs)-2].Role != llm.RoleTool {
+		t.Fatalf("unexpected transcript tail: %+v", msgs[len(msgs)-2:])
+	}
+}
+
+func TestSharedBudgetSpansAgents(t *testing.T) {
+	used := textResponse("ok")
+	used.Usage = llm.Usage{TotalTokens: 60}
+	shared := NewBudgetTracker(Budget{MaxTokens: 100})
+	first := NewAgent(newFakeChatModel(used, used), false)
+	second := NewAgent(newFakeChatModel(used), false)
+	first.SetSharedBudget(shared)
+	second.SetSharedBudget(shared)
+
+	if _, err := first.Invoke(context.Background(), "one"); err != nil {
+		t.Fatalf("first Invoke: %v", err)
+	}
+	if _, err := second.Invoke(context.Background(), "two"); err != nil {
+		t.Fatalf("second Invoke: %v", err)
+	}
+	_, err := first.Invoke(context.Background(), "three")
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Scope != "shared" || budgetErr.Limit != BudgetLimitTokens {
+		t.Fatalf("err = %v, want shared token budget error", err)
+	}
+	if got := shared.Spent().Tokens; got != 120 {
+		t.Fatalf("shared tokens = %d, want 120", got)
+	}
+}
+
+// stallingChatModel blocks every request until its context is done.
+type stallingChatModel struct{ fakeChatModel }
+
+func (m *stallingChatModel) Chat(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *stallingChatModel) ChatStream(ctx context.Context, req llm.Request, _ llm.StreamFunc) (*llm.Response, error) {
+	return m.Chat(ctx, req)
+}
+
+func TestMaxDurationCancelsCallsInFlight(t *testing.T) {
+	a := NewAgent(&stallingChatModel{}, false)
+	a.InvokeBudget = Budget{MaxDuration: 20 * time.Millisecond}
+	start := time.Now()
+	_, err := a.Invoke(context.Background(), "hi")
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Limit != BudgetLimitDuration {
+		t.Fatalf("err = %v, want a duration budget error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("model call ran %v past the budget", elapsed)
+	}
+
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "wait", Arguments: `{}`}),
+		textResponse("best effort"),
+	)
+	a = NewAgent(model, true)
+	a.RegisterToolFunc("wait", func(ctx context.Context, _ string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	a.InvokeBudget = Budget{MaxDuration: 20 * time.Millisecond}
+	a.BudgetFinalAnswer = true
+	result, err := a.InvokeWithResult(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	if !result.Partial || !errors.Is(result.StopReason, ErrBudgetExceeded) || result.Content != "best effort" {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestSessionBudgetOnZeroConversation(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`}),
+		textResponse("done"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+	a.SessionBudget = Budget{MaxToolCalls: 5}
+	conv := &Conversation{}
+	a.SetConversation(conv)
+
+	if _, err := a.Invoke(context.Background(), "go"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if spent := conv.BudgetSpent(); spent.ToolCalls != 1 {
+		t.Fatalf("session spent %+v", spent)
+	}
+}
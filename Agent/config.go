@@ -1,36 +1,127 @@
 package agent
 
 import (
+	"fmt"
 	"log"
 	"strings"
+	"time"
+
+	"agent/llm"
 
 	"github.com/spf13/viper"
 )
 
 type AgentConfig struct {
-	APIKey       string           `mapstructure:"api_key"`
-	BaseURL      string           `mapstructure:"base_url"`
-	Model        string           `mapstructure:"model"`
-	AllowTools   bool             `mapstructure:"allow_tools"`
-	SystemPrompt string           `mapstructure:"system_prompt"`
-	Temperature  float32          `mapstructure:"temperature"`
-	MaxCircle    int              `mapstructure:"max_circle"`
-	ReAct        ReActAgentConfig `mapstructure:"react"`
+	APIKey             string            `mapstructure:"api_key"`
+	BaseURL            string            `mapstructure:"base_url"`
+	Model              string            `mapstructure:"model"`
+	AllowTools         bool              `mapstructure:"allow_tools"`
+	SystemPrompt       string            `mapstructure:"system_prompt"`
+	Temperature        float32           `mapstructure:"temperature"`
+	MaxCircle          int               `mapstructure:"max_circle"`
+	FinalAnswerOnLimit bool              `mapstructure:"final_answer_on_limit"` // answer without tools when max_circle is reached
+	MaxParallelTools   int               `mapstructure:"max_parallel_tools"`    // concurrent tool calls per turn
+	SerialTools        []string          `mapstructure:"serial_tools"`          // tools that always run alone
+	UnknownToolPolicy  string            `mapstructure:"unknown_tool_policy"`   // report, fuzzy_match, fail
+	ToolTimeout        time.Duration     `mapstructure:"tool_timeout"`          // default per-call tool timeout, e.g. "30s"
+	ReAct              ReActAgentConfig  `mapstructure:"react"`
+	PlanExecute        PlanExecuteConfig `mapstructure:"plan_execute"`
+	Reflection         ReflectionConfig  `mapstructure:"reflection"`
+	Prompts            PromptsConfig     `mapstructure:"prompts"`
+	Memory             MemoryConfig      `mapstructure:"memory"`
+	Context            ContextConfig     `mapstructure:"context"`
+	Pricing            PriceTable        `mapstructure:"pricing"` // per-model prices per million tokens
+	Budget             BudgetConfig      `mapstructure:"budget"`
+	Retry              llm.RetryPolicy   `mapstructure:"retry"` // retries of failed model calls
+	Fallback           FallbackConfig    `mapstructure:"fallback"`
 }
 
 type ReActAgentConfig struct {
-	Enabled bool `mapstructure:"enabled"`
+	Enabled bool   `mapstructure:"enabled"`
+	Mode    string `mapstructure:"mode"` // native (tool-calling API) or text (ReAct prompt protocol)
+}
+
+// PlanExecuteConfig selects the plan-and-execute agent.
+type PlanExecuteConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	MaxSteps int  `mapstructure:"max_steps"` // executed steps per request
+}
+
+// ReflectionConfig enables the critic that reviews draft answers.
+type ReflectionConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	MaxRounds int    `mapstructure:"max_rounds"` // revisions per request
+	Model     string `mapstructure:"model"`      // critic model, empty = the agent's model
+}
+
+// PromptsConfig selects a system prompt template from a prompts directory.
+type PromptsConfig struct {
+	Dir    string         `mapstructure:"dir"`    // directory of *.tmpl files and partials/
+	System string         `mapstructure:"system"` // template used as system prompt, empty = system_prompt
+	Vars   map[string]any `mapstructure:"vars"`   // default template variables; keys arrive lower-cased and match declared vars ignoring case
+}
+
+// MemoryConfig enables long-term memory backed by an embedding model.
+type MemoryConfig struct {
+	Enabled    bool    `mapstructure:"enabled"`
+	Model      string  `mapstructure:"model"`    // embedding model
+	BaseURL    string  `mapstructure:"base_url"` // defaults to the primary base_url
+	APIKey     string  `mapstructure:"api_key"`  // defaults to the primary api_key
+	Dimensions int     `mapstructure:"dimensions"`
+	TopK       int     `mapstructure:"top_k"`     // memories recalled per request
+	MinScore   float64 `mapstructure:"min_score"` // minimum similarity of a recalled memory
+	File       string  `mapstructure:"file"`      // keeps memories between runs, empty = not saved
+}
+
+// ContextConfig controls context-window management.
+type ContextConfig struct {
+	Budget             int    `mapstructure:"budget"`                // prompt token budget, 0 = derive from model
+	Policy             string `mapstructure:"policy"`                // drop_oldest, truncate_tool_results, summarize
+	MaxToolResultChars int    `mapstructure:"max_tool_result_chars"` // used by truncate_tool_results
+}
+
+// BudgetConfig limits spend per invocation and per conversation.
+type BudgetConfig struct {
+	Invocation  Budget `mapstructure:"invocation"`
+	Session     Budget `mapstructure:"session"`
+	FinalAnswer bool   `mapstructure:"final_answer"` // ask for a best-effort answer when a budget runs out
+}
+
+// FallbackConfig lists models tried in order when the primary model fails.
+// OnErrors and Latency are the rules for leaving the primary model.
+type FallbackConfig struct {
+	OnErrors []string              `mapstructure:"on_errors"` // error kinds, empty = llm.DefaultFallbackErrors
+	Latency  time.Duration         `mapstructure:"latency"`   // move on when no answer arrives in time
+	Models   []FallbackModelConfig `mapstructure:"models"`
+}
+
+// FallbackModelConfig is one fallback model and the rules for leaving it.
+type FallbackModelConfig struct {
+	Model    string        `mapstructure:"model"`
+	BaseURL  string        `mapstructure:"base_url"` // defaults to the primary base_url
+	APIKey   string        `mapstructure:"api_key"`  // defaults to the primary api_key
+	OnErrors []string      `mapstructure:"on_errors"`
+	Latency  time.Duration `mapstructure:"latency"`
 }
 
 func DefaultAgentConfig() AgentConfig {
 	return AgentConfig{
-		BaseURL:      "",
-		Model:        "",
-		AllowTools:   true,
-		SystemPrompt: DefaultSystemPrompt,
-		Temperature:  DefaultTemperature,
-		MaxCircle:    DefaultMaxCircle,
-		ReAct:        ReActAgentConfig{Enabled: false},
+		BaseURL:           "",
+		Model:             "",
+		AllowTools:        true,
+		SystemPrompt:      DefaultSystemPrompt,
+		Temperature:       DefaultTemperature,
+		MaxCircle:         DefaultMaxCircle,
+		MaxParallelTools:  DefaultMaxParallelTools,
+		UnknownToolPolicy: string(UnknownToolReport),
+		ToolTimeout:       DefaultToolTimeout,
+		ReAct:             ReActAgentConfig{Enabled: false, Mode: "native"},
+		PlanExecute:       PlanExecuteConfig{Enabled: false, MaxSteps: DefaultMaxPlanSteps},
+		Reflection:        ReflectionConfig{Enabled: false, MaxRounds: DefaultReflectionRounds},
+		Prompts:           PromptsConfig{Dir: "prompts"},
+		Memory:            MemoryConfig{TopK: DefaultMemoryTopK},
+		Context:           ContextConfig{Policy: "drop_oldest"},
+		Retry:             llm.DefaultRetryPolicy(),
 	}
 }
 
@@ -55,5 +146,52 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	if _, err := ParseUnknownToolPolicy(cfg.UnknownToolPolicy); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// NewChatModel builds the configured model, wrapped in an
+// llm.FallbackChatModel when fallbacks are configured.
+func NewChatModel(cfg *AgentConfig) (llm.ChatModel, error) {
+	primary := llm.NewOpenAIChatModel(cfg.APIKey, cfg.BaseURL, cfg.Model)
+	if len(cfg.Fallback.Models) == 0 {
+		return primary, nil
+	}
+	entry, err := fallbackEntry(primary, cfg.Fallback.OnErrors, cfg.Fallback.Latency)
+	if err != nil {
+		return nil, err
+	}
+	fallbacks := make([]llm.FallbackEntry, 0, len(cfg.Fallback.Models))
+	for _, m := range cfg.Fallback.Models {
+		if m.Model == "" {
+			return nil, fmt.Errorf("fallback model name is required")
+		}
+		apiKey, baseURL := m.APIKey, m.BaseURL
+		if apiKey == "" {
+			apiKey = cfg.APIKey
+		}
+		if baseURL == "" {
+			baseURL = cfg.BaseURL
+		}
+		fb, err := fallbackEntry(llm.NewOpenAIChatModel(apiKey, baseURL, m.Model), m.OnErrors, m.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("fallback %s: %w", m.Model, err)
+		}
+		fallbacks = append(fallbacks, fb)
+	}
+	return llm.NewFallbackChatModel(entry, fallbacks...), nil
+}
+
+func fallbackEntry(model llm.ChatModel, onErrors []string, latency time.Duration) (llm.FallbackEntry, error) {
+	entry := llm.FallbackEntry{Model: model, Latency: latency}
+	for _, name := range onErrors {
+		kind, err := llm.ParseErrorKind(name)
+		if err != nil {
+			return llm.FallbackEntry{}, err
+		}
+		entry.OnErrors = append(entry.OnErrors, kind)
+	}
+	return entry, nil
+}
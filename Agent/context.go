@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"agent/llm"
+)
+
+const (
+	// messageTokenOverhead approximates the role/formatting tokens the
+	// provider adds around every message.
+	messageTokenOverhead = 4
+	// attachmentTokens is charged per image or file part.
+	attachmentTokens     = 765
+	summaryPrefix        = "Summary of earlier conversation:\n"
+	DefaultSummaryPrompt = "Summarize the conversation below for your own future reference. Keep user goals, decisions, facts and tool results that may be needed later. Be concise."
+)
+
+// TokenEstimator approximates how many tokens a text costs for a model.
+type TokenEstimator interface {
+	EstimateTokens(text string) int
+}
+
+// HeuristicEstimator counts CJK characters as one token each and other
+// text as CharsPerToken characters per token.
+type HeuristicEstimator struct {
+	CharsPerToken float64
+}
+
+func (e HeuristicEstimator) EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	charsPerToken := e.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4
+	}
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + int(math.Ceil(float64(other)/charsPerToken))
+}
+
+type modelProfile struct {
+	prefix        string
+	contextWindow int
+	charsPerToken float64
+}
+
+// modelProfiles is matched by longest prefix, so more specific names win.
+var modelProfiles = []modelProfile{
+	{prefix: "gpt-4.1", contextWindow: 1047576, charsPerToken: 4},
+	{prefix: "gpt-4o", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4-turbo", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4", contextWindow: 8192, charsPerToken: 4},
+	{prefix: "gpt-3.5-turbo", contextWindow: 16385, charsPerToken: 4},
+	{prefix: "o1", contextWindow: 200000, charsPerToken: 4},
+	{prefix: "o3", contextWindow: 200000, charsPerToken: 4},
+	{prefix: "deepseek", contextWindow: 64000, charsPerToken: 3.5},
+	{prefix: "qwen", contextWindow: 32768, charsPerToken: 3.5},
+	{prefix: "glm", contextWindow: 128000, charsPerToken: 3.5},
+}
+
+func lookupModelProfile(model string) (modelProfile, bool) {
+	model = strings.ToLower(model)
+	var best modelProfile
+	found := false
+	for _, p := range modelProfiles {
+		if strings.HasPrefix(model, p.prefix) && len(p.prefix) > len(best.prefix) {
+			best = p
+			found = true
+		}
+	}
+	return best, found
+}
+
+// EstimatorForModel returns the token estimator used for model.
+func EstimatorForModel(model string) TokenEstimator {
+	if p, ok := lookupModelProfile(model); ok {
+		return HeuristicEstimator{CharsPerToken: p.charsPerToken}
+	}
+	return HeuristicEstimator{CharsPerToken: 4}
+}
+
+// ContextWindowForModel returns the known context window of model in
+// tokens, or 0 when the model is unknown.
+func ContextWindowForModel(model string) int {
+	if p, ok := lookupModelProfile(model); ok {
+		return p.contextWindow
+	}
+	return 0
+}
+
+// EstimateMessageTokens approximates the prompt tokens of messages.
+func EstimateMessageTokens(est TokenEstimator, messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += messageTokenOverhead + est.EstimateTokens(msg.Content) + est.EstimateTokens(msg.Name)
+		for _, call := range msg.ToolCalls {
+			total += est.EstimateTokens(call.Name) + est.EstimateTokens(call.Arguments)
+		}
+		for _, part := range msg.Parts {
+			if part.Type == llm.PartText {
+				total += est.EstimateTokens(part.Text)
+				continue
+			}
+			// Images and files are billed by size, not by their base64
+			// text, so count a flat high-detail image cost.
+			total += attachmentTokens
+		}
+	}
+	return total
+}
+
+// ContextPolicy shrinks the conversation history when the prompt no longer
+// fits the context budget. history holds the replayed conversation followed
+// by the turn in progress; everything from the last message written by the
+// user on must be kept. Fit returns the best effort result even if it still
+// exceeds budget.
+type ContextPolicy interface {
+	Fit(ctx context.Context, history []Message, budget int, est TokenEstimator) ([]Message, error)
+}
+
+// DropOldestPolicy removes the oldest turns first.
+type DropOldestPolicy struct{}
+
+func (DropOldestPolicy) Fit(_ context.Context, history []Message, budget int, est TokenEstimator) ([]Message, error) {
+	groups := splitTurns(history)
+	for len(groups) > 1 && EstimateMessageTokens(est, joinTurns(groups)) > budget {
+		groups = groups[1:]
+	}
+	return joinTurns(groups), nil
+}
+
+// TruncateToolResultsPolicy cuts tool results down to MaxChars characters,
+// oldest first, until the history fits.
+type TruncateToolResultsPolicy struct {
+	MaxChars int
+}
+
+func (p TruncateToolResultsPolicy) Fit(_ context.Context, history []Message, budget int, est TokenEstimator) ([]Message, error) {
+	maxChars := p.MaxChars
+	if maxChars <= 0 {
+		maxChars = 2000
+	}
+	out := make([]Message, len(history))
+	copy(out, history)
+	total := EstimateMessageTokens(est, out)
+	for i := range out {
+		if total <= budget {
+			break
+		}
+		if out[i].Role != llm.RoleTool {
+			continue
+		}
+		truncated := truncateText(out[i].Content, maxChars)
+		total += est.EstimateTokens(truncated) - est.EstimateTokens(out[i].Content)
+		out[i].Content = truncated
+	}
+	return out, nil
+}
+
+// SummarizePolicy asks Model to fold older turns into a running summary
+// that is kept as a system message at the start of the history. Summaries
+// are retried and counted in the usage and budgets of the invocation.
+type SummarizePolicy struct {
+	Model     llm.ChatModel
+	KeepTurns int    // most recent turns kept verbatim, at least 1
+	Prompt    string // instructions for the summarizer
+}
+
+func (p SummarizePolicy) Fit(ctx context.Context, history []Message, budget int, est TokenEstimator) ([]Message, error) {
+	if p.Model == nil {
+		return nil, fmt.Errorf("summarize policy: model is required")
+	}
+	if EstimateMessageTokens(est, history) <= budget {
+		return history, nil
+	}
+	keep := p.KeepTurns
+	if keep < 1 {
+		keep = 1
+	}
+	groups := splitTurns(history)
+	if len(groups) <= keep {
+		return history, nil
+	}
+	older := joinTurns(groups[:len(groups)-keep])
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	resp, err := policyChat(ctx, p.Model, llm.Request{
+		Messages: []Message{
+			{Role: llm.RoleSystem, Content: prompt},
+			{Role: llm.RoleUser, Content: renderTranscript(older)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("summarize history: %w", err)
+	}
+	summary := Message{Role: llm.RoleSystem, Content: summaryPrefix + strings.TrimSpace(resp.Message.Content)}
+	return append([]Message{summary}, joinTurns(groups[len(groups)-keep:])...), nil
+}
+
+// policyChatFunc runs a completion on behalf of a context policy.
+type policyChatFunc func(ctx context.Context, model llm.ChatModel, req llm.Request) (*llm.Response, error)
+
+type policyChatKey struct{}
+
+// policyChat sends a context policy's request to model. Within fitContext it
+// is retried and its usage counted like any other completion of the call.
+func policyChat(ctx context.Context, model llm.ChatModel, req llm.Request) (*llm.Response, error) {
+	if chat, ok := ctx.Value(policyChatKey{}).(policyChatFunc); ok {
+		return chat(ctx, model, req)
+	}
+	return model.Chat(ctx, req)
+}
+
+// ChainPolicy applies policies in order until the history fits.
+type ChainPolicy []ContextPolicy
+
+func (c ChainPolicy) Fit(ctx context.Context, history []Message, budget int, est TokenEstimator) ([]Message, error) {
+	var err error
+	for _, policy := range c {
+		if EstimateMessageTokens(est, history) <= budget {
+			break
+		}
+		history, err = policy.Fit(ctx, history, budget, est)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// NewContextPolicy builds a policy by name: drop_oldest, truncate_tool_results
+// or summarize. model is only used by summarize.
+func NewContextPolicy(name string, maxToolResultChars int, model llm.ChatModel) (ContextPolicy, error) {
+	switch name {
+	case "", "drop_oldest":
+		return DropOldestPolicy{}, nil
+	case "truncate_tool_results":
+		return ChainPolicy{TruncateToolResultsPolicy{MaxChars: maxToolResultChars}, DropOldestPolicy{}}, nil
+	case "summarize":
+		return ChainPolicy{SummarizePolicy{Model: model}, DropOldestPolicy{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown context policy %q", name)
+	}
+}
+
+// contextBudget returns the prompt token budget, derived from the model's
+// context window when ContextBudget is unset. 0 disables context management.
+// A model that falls back on context overflow is given the largest window
+// of its chain, so an overflow reaches the larger model instead of being
+// compacted away; an unknown window in the chain disables compaction.
+func (a *Agent) contextBudget() int {
+	if a.ContextBudget > 0 {
+		return a.ContextBudget
+	}
+	names := []string{a.model.ModelName()}
+	if m, ok := a.model.(llm.OverflowFallbackModel); ok {
+		names = m.OverflowModelNames()
+	}
+	window := 0
+	for _, name := range names {
+		w := ContextWindowForModel(name)
+		if w == 0 {
+			return 0
+		}
+		window = max(window, w)
+	}
+	return window * 3 / 4
+}
+
+func (a *Agent) tokenEstimator() TokenEstimator {
+	if a.TokenEstimator != nil {
+		return a.TokenEstimator
+	}
+	return EstimatorForModel(a.model.ModelName())
+}
+
+// fitContext applies the context policy to messages when they exceed the
+// context budget. The leading prefix messages (system prompt) are never touched.
+// Completions made by the policy are added to result and budget. It reports
+// whether the history was changed.
+func (a *Agent) fitContext(ctx context.Context, messages []Message, prefix int, toolDefs []llm.ToolDefinition, result *InvokeResult, budget budgets) ([]Message, bool, error) {
+	tokens := a.contextBudget()
+	if tokens <= 0 {
+		return messages, false, nil
+	}
+	est := a.tokenEstimator()
+	fixed := EstimateMessageTokens(est, messages[:prefix])
+	if len(toolDefs) > 0 {
+		if data, err := json.Marshal(toolDefs); err == nil {
+			fixed += est.EstimateTokens(string(data))
+		}
+	}
+	if fixed+EstimateMessageTokens(est, messages[prefix:]) <= tokens {
+		return messages, false, nil
+	}
+	policy := a.ContextPolicy
+	if policy == nil {
+		policy = DropOldestPolicy{}
+	}
+	ctx = context.WithValue(ctx, policyChatKey{}, policyChatFunc(func(ctx context.Context, model llm.ChatModel, req llm.Request) (*llm.Response, error) {
+		resp, err := a.completeWith(ctx, model, req, nil)
+		if err != nil {
+			return nil, err
+		}
+		budget.addUsage(resp.Usage, a.countUsage(result, model, resp))
+		return resp, nil
+	}))
+	history, err := policy.Fit(ctx, messages[prefix:], tokens-fixed, est)
+	if err != nil {
+		return nil, false, fmt.Errorf("fit context: %w", err)
+	}
+	out := make([]Message, 0, prefix+len(history))
+	out = append(out, messages[:prefix]...)
+	return append(out, history...), true, nil
+}
+
+// splitTurns groups history into turns that each start at a message
+// written by the user, so tool calls always stay together with their
+// results and the messages the agent added to the turn.
+func splitTurns(history []Message) [][]Message {
+	var groups [][]Message
+	for i, msg := range history {
+		if i == 0 || (msg.Role == llm.RoleUser && !msg.Synthetic) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], msg)
+	}
+	return groups
+}
+
+func joinTurns(groups [][]Message) []Message {
+	var out []Message
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
+
+func truncateText(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return fmt.Sprintf("%s\n...[truncated %d characters]", string(runes[:maxChars]), len(runes)-maxChars)
+}
+
+func renderTranscript(messages []Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		switch {
+		case msg.Role == llm.RoleTool:
+			fmt.Fprintf(&b, "tool %s result: %s\n", msg.Name, msg.Content)
+		case len(msg.ToolCalls) > 0:
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "assistant called %s(%s)\n", call.Name, call.Arguments)
+			}
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "assistant: %s\n", msg.Content)
+			}
+		default:
+			fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.Content)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+func seedTurn(question, answer string) []Message {
+	return []Message{
+		{Role: llm.RoleUser, Content: question},
+		{Role: llm.RoleAssistant, Content: answer},
+	}
+}
+
+func requestContains(req llm.Request, text string) bool {
+	for _, msg := range req.Messages {
+		if strings.Contains(msg.Content, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHeuristicEstimator(t *testing.T) {
+	est := HeuristicEstimator{CharsPerToken: 4}
+	if got := est.EstimateTokens("abcdefgh"); got != 2 {
+		t.Fatalf("latin tokens = %d, want 2", got)
+	}
+	if got := est.EstimateTokens("你好"); got != 2 {
+		t.Fatalf("cjk tokens = %d, want 2", got)
+	}
+	if ContextWindowForModel("gpt-4o-mini") != 128000 {
+		t.Fatalf("gpt-4o-mini should match the gpt-4o profile")
+	}
+}
+
+func TestDropOldestPolicy(t *testing.T) {
+	model := newFakeChatModel(textResponse("fresh answer"))
+	a := NewAgent(model, false)
+	a.ContextBudget = 150
+	a.ContextPolicy = DropOldestPolicy{}
+	a.Conversation().Append(seedTurn("old question "+strings.Repeat("a", 800), "old answer")...)
+	a.Conversation().Append(seedTurn("recent question", "recent answer")...)
+
+	if _, err := a.Invoke(context.Background(), "new question"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	req := model.Requests()[0]
+	if requestContains(req, "old question") {
+		t.Fatal("oldest turn should have been dropped")
+	}
+	if !requestContains(req, "recent question") || !requestContains(req, "new question") {
+		t.Fatal("recent turns must be kept")
+	}
+	history := a.Conversation().Messages()
+	if history[0].Content != "recent question" {
+		t.Fatalf("conversation should start at the recent turn, got %q", history[0].Content)
+	}
+}
+
+func TestTruncateToolResultsPolicy(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "dump", Arguments: `{}`}),
+		textResponse("done"),
+	)
+	a := NewAgent(model, true)
+	a.ContextBudget = 300
+	a.ContextPolicy = TruncateToolResultsPolicy{MaxChars: 100}
+	a.RegisterTool(tools.New("dump", func(context.Context, string) (string, error) {
+		return strings.Repeat("x", 4000), nil
+	}))
+
+	if _, err := a.Invoke(context.Background(), "dump it"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	req := model.Requests()[1]
+	toolMsg := req.Messages[len(req.Messages)-1]
+	if toolMsg.Role != llm.RoleTool {
+		t.Fatalf("last message role = %q, want tool", toolMsg.Role)
+	}
+	if len(toolMsg.Content) > 200 || !strings.Contains(toolMsg.Content, "[truncated 3900 characters]") {
+		t.Fatalf("tool result not truncated: %d chars", len(toolMsg.Content))
+	}
+}
+
+func TestSummarizePolicy(t *testing.T) {
+	summary := textResponse("user asked about the old topic")
+	summary.Usage = llm.Usage{PromptTokens: 300, CompletionTokens: 20, TotalTokens: 320}
+	summarizer := newFakeChatModel(summary)
+	summarizer.failures = []error{&llm.Error{Kind: llm.ErrorRateLimit, StatusCode: 429, Err: errors.New("slow down")}}
+	model := newFakeChatModel(textResponse("fresh answer"))
+	a := NewAgent(model, false)
+	a.ContextBudget = 200
+	a.ContextPolicy = SummarizePolicy{Model: summarizer}
+	a.Retry = llm.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	a.Conversation().Append(seedTurn("old question "+strings.Repeat("a", 400), "old answer")...)
+	a.Conversation().Append(seedTurn("older follow-up "+strings.Repeat("b", 400), "follow-up answer")...)
+
+	result, err := a.InvokeWithResult(context.Background(), "new question")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	if result.Usage.TotalTokens != 320 || a.Conversation().Usage().Usage.TotalTokens != 320 {
+		t.Fatalf("summarizer usage not counted: %+v", result.Usage)
+	}
+	sumReqs := summarizer.Requests()
+	if len(sumReqs) != 2 || !requestContains(sumReqs[0], "old question") || !requestContains(sumReqs[0], "older follow-up") {
+		t.Fatalf("summarizer should receive the older turns: %+v", sumReqs)
+	}
+	req := model.Requests()[0]
+	if requestContains(req, "old question") {
+		t.Fatal("summarized turns should not be replayed verbatim")
+	}
+	if !requestContains(req, summaryPrefix+"user asked about the old topic") {
+		t.Fatal("running summary missing from request")
+	}
+	history := a.Conversation().Messages()
+	if history[0].Role != llm.RoleSystem || !strings.HasPrefix(history[0].Content, summaryPrefix) {
+		t.Fatalf("conversation should keep the running summary, got %+v", history[0])
+	}
+}
+
+func TestDropOldestKeepsQueryOfToolAttachments(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "screenshot", Arguments: `{}`}),
+		textResponse("I see it"),
+	)
+	a := NewAgent(model, true)
+	a.ContextBudget = 600
+	a.ContextPolicy = DropOldestPolicy{}
+	a.RegisterToolFunc("screenshot", func(ctx context.Context, _ string) (string, error) {
+		tools.Attach(ctx, llm.ImageURLPart("data:image/png;base64,AAAA"))
+		return "captured", nil
+	})
+	a.Conversation().Append(seedTurn("old question", "old answer")...)
+
+	if _, err := a.Invoke(context.Background(), "take a screenshot"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	req := model.Requests()[1]
+	if requestContains(req, "old question") {
+		t.Fatal("oldest turn should have been dropped")
+	}
+	if !requestContains(req, "take a screenshot") || !requestContains(req, "captured") {
+		t.Fatalf("the attachment message must not split the turn: %+v", req.Messages)
+	}
+	history := a.Conversation().Messages()
+	if history[0].Content != "take a screenshot" {
+		t.Fatalf("conversation should start at the query, got %+v", history[0])
+	}
+}
+
+// namedModel reports a different model name for a wrapped model.
+type namedModel struct {
+	llm.ChatModel
+	name string
+}
+
+func (m namedModel) ModelName() string { return m.name }
+
+func TestContextOverflowReachesLargerFallback(t *testing.T) {
+	small := newFakeChatModel()
+	small.failures = []error{&llm.Error{Kind: llm.ErrorContextLength, Err: errors.New("prompt too long")}}
+	large := newFakeChatModel(textResponse("answered"))
+	a := NewAgent(llm.NewFallbackChatModel(
+		llm.FallbackEntry{Model: namedModel{small, "gpt-4"}},
+		llm.FallbackEntry{Model: namedModel{large, "gpt-4o"}},
+	), false)
+	// About 8000 tokens: over the budget of gpt-4, within that of gpt-4o.
+	a.Conversation().Append(seedTurn(strings.Repeat("old ", 8000), "old answer")...)
+
+	answer, err := a.Invoke(context.Background(), "new question")
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if answer != "answered" || len(small.Requests()) != 1 {
+		t.Fatalf("answer = %q after %d primary calls", answer, len(small.Requests()))
+	}
+	if !requestContains(large.Requests()[0], "old old") {
+		t.Fatal("history was compacted before the larger model could take it")
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import "sync"
+
+// Conversation stores the ordered transcript of a chat session: user,
+// assistant, tool-call and tool-result messages. It is replayed to the
+// model as role messages on every Invoke and is safe for concurrent use.
+type Conversation struct {
+	mu       sync.RWMutex
+	messages []Message
+	usage    usageCounter
+	budget   *BudgetTracker
+	// parent is the conversation this one branched from; it owns budget
+	// and also counts the usage.
+	parent *Conversation
+}
+
+// NewConversation creates an empty conversation, optionally seeded with
+// messages.
+func NewConversation(messages ...Message) *Conversation {
+	c := &Conversation{}
+	c.Append(messages...)
+	return c
+}
+
+// Append adds messages to the end of the transcript.
+func (c *Conversation) Append(messages ...Message) {
+	if len(messages) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, messages...)
+}
+
+// Replace swaps the whole transcript, e.g. after older turns have been
+// summarized or dropped.
+func (c *Conversation) Replace(messages []Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append([]Message(nil), messages...)
+}
+
+// Messages returns a copy of the transcript in order.
+func (c *Conversation) Messages() []Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Message, len(c.messages))
+	copy(out, c.messages)
+	return out
+}
+
+// Len returns the number of messages in the transcript.
+func (c *Conversation) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.messages)
+}
+
+// Fork returns an independent copy of the conversation, so that a branch
+// can continue without affecting the original. The fork starts with a
+// fresh session budget.
+func (c *Conversation) Fork() *Conversation {
+	return NewConversation(c.Messages()...)
+}
+
+// branch returns a conversation seeded with messages whose usage counts
+// against c and its session budget, for work done on behalf of c.
+func (c *Conversation) branch(messages ...Message) *Conversation {
+	b := NewConversation(messages...)
+	b.budget = c.sessionBudget()
+	b.parent = c
+	return b
+}
+
+// Reset clears the transcript.
+func (c *Conversation) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = nil
+}
+
+// BudgetSpent returns the spend counted against the session budget.
+func (c *Conversation) BudgetSpent() BudgetSpend {
+	return c.sessionBudget().Spent()
+}
+
+// sessionBudget returns the session's tracker, creating it on first use so
+// that a zero Conversation works.
+func (c *Conversation) sessionBudget() *BudgetTracker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget == nil {
+		c.budget = newBudgetTracker("session", Budget{})
+	}
+	return c.budget
+}
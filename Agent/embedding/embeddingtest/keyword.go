@@ -0,0 +1,53 @@
+// Package embeddingtest provides an embedder for tests.
+package embeddingtest
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"agent/embedding"
+)
+
+// KeywordEmbedder embeds a text as counts of a few keywords, so similar
+// texts are easy to write by hand.
+type KeywordEmbedder struct {
+	keywords []string
+	batches  atomic.Int64
+}
+
+// NewKeywordEmbedder creates an embedder with one dimension per keyword.
+// Keywords are matched in lower case.
+func NewKeywordEmbedder(keywords ...string) *KeywordEmbedder {
+	return &KeywordEmbedder{keywords: keywords}
+}
+
+func (e *KeywordEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	vector := make([]float32, len(e.keywords))
+	for i, kw := range e.keywords {
+		vector[i] = float32(strings.Count(strings.ToLower(text), kw))
+	}
+	return vector, nil
+}
+
+func (e *KeywordEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.batches.Add(1)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = e.Embed(ctx, text)
+	}
+	return vectors, nil
+}
+
+func (e *KeywordEmbedder) BatchEmbedWithPool(ctx context.Context, model embedding.Embedder, texts []string) ([][]float32, error) {
+	return model.BatchEmbed(ctx, texts)
+}
+
+// Batches returns how many times BatchEmbed was called.
+func (e *KeywordEmbedder) Batches() int {
+	return int(e.batches.Load())
+}
+
+func (*KeywordEmbedder) GetModelName() string { return "keywords" }
+func (e *KeywordEmbedder) GetDimensions() int { return len(e.keywords) }
+func (*KeywordEmbedder) GetModelID() string   { return "keywords" }
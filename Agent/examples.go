@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"agent/embedding"
+	"agent/llm"
+)
+
+// DefaultExampleCount is how many examples a SimilarityExampleSelector
+// picks when K is unset.
+const DefaultExampleCount = 3
+
+// FewShotExample is a worked example: the user's Input, the assistant's
+// tool calls with their results, and the assistant's final Output. Agents
+// replay it as real chat messages; templates render it as text with the
+// fewshot function.
+type FewShotExample struct {
+	Input     string            `yaml:"input" json:"input"`
+	ToolCalls []ExampleToolCall `yaml:"tool_calls" json:"tool_calls,omitempty"`
+	Output    string            `yaml:"output" json:"output"`
+}
+
+// ExampleToolCall is one tool call of a FewShotExample and what the tool
+// returned.
+type ExampleToolCall struct {
+	Name      string `yaml:"name" json:"name"`
+	Arguments string `yaml:"arguments" json:"arguments"`
+	Result    string `yaml:"result" json:"result"`
+}
+
+// Messages renders the example as user, assistant and tool messages. n
+// numbers the example so that tool call IDs stay unique.
+func (e FewShotExample) Messages(n int) []Message {
+	messages := []Message{{Role: llm.RoleUser, Content: e.Input}}
+	if len(e.ToolCalls) > 0 {
+		calls := make([]llm.ToolCall, len(e.ToolCalls))
+		results := make([]Message, len(e.ToolCalls))
+		for i, call := range e.ToolCalls {
+			id := fmt.Sprintf("example_%d_%d", n, i+1)
+			calls[i] = llm.ToolCall{ID: id, Name: call.Name, Arguments: call.Arguments}
+			results[i] = Message{Role: llm.RoleTool, ToolCallID: id, Name: call.Name, Content: call.Result}
+		}
+		messages = append(messages, Message{Role: llm.RoleAssistant, ToolCalls: calls})
+		messages = append(messages, results...)
+	}
+	return append(messages, Message{Role: llm.RoleAssistant, Content: e.Output})
+}
+
+// exampleMessages renders examples in order.
+func exampleMessages(examples []FewShotExample) []Message {
+	var messages []Message
+	for i, e := range examples {
+		messages = append(messages, e.Messages(i+1)...)
+	}
+	return messages
+}
+
+// ExampleSelector picks the few-shot examples for a query.
+type ExampleSelector interface {
+	Select(ctx context.Context, query string) ([]FewShotExample, error)
+}
+
+// SimilarityExampleSelector picks the K examples whose inputs are most
+// similar to the query by embedding cosine similarity.
+type SimilarityExampleSelector struct {
+	K        int
+	embedder embedding.Embedder
+
+	mu       sync.RWMutex
+	examples []FewShotExample
+	vectors  [][]float32
+}
+
+// NewSimilarityExampleSelector embeds the inputs of examples with embedder
+// and returns a selector picking k of them per query.
+func NewSimilarityExampleSelector(ctx context.Context, embedder embedding.Embedder, k int, examples ...FewShotExample) (*SimilarityExampleSelector, error) {
+	s := &SimilarityExampleSelector{K: k, embedder: embedder}
+	if err := s.Add(ctx, examples...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add embeds and adds examples.
+func (s *SimilarityExampleSelector) Add(ctx context.Context, examples ...FewShotExample) error {
+	if len(examples) == 0 {
+		return nil
+	}
+	inputs := make([]string, len(examples))
+	for i, e := range examples {
+		inputs[i] = e.Input
+	}
+	vectors, err := s.embedder.BatchEmbed(ctx, inputs)
+	if err != nil {
+		return fmt.Errorf("embed examples: %w", err)
+	}
+	if len(vectors) != len(examples) {
+		return fmt.Errorf("embed examples: got %d vectors for %d examples", len(vectors), len(examples))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples = append(s.examples, examples...)
+	s.vectors = append(s.vectors, vectors...)
+	return nil
+}
+
+// Select returns the K most similar examples, least similar first, so the
+// closest example is nearest to the query in the prompt.
+func (s *SimilarityExampleSelector) Select(ctx context.Context, query string) ([]FewShotExample, error) {
+	s.mu.RLock()
+	empty := len(s.examples) == 0
+	s.mu.RUnlock()
+	if empty {
+		return nil, nil
+	}
+	// The query is embedded without the lock, so a slow embedder does not
+	// hold up Add.
+	vector, err := s.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	order := make([]int, len(s.examples))
+	scores := make([]float64, len(s.examples))
+	for i := range s.examples {
+		order[i] = i
+		scores[i] = embedding.CosineSimilarity(vector, s.vectors[i])
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	k := s.K
+	if k <= 0 {
+		k = DefaultExampleCount
+	}
+	k = min(k, len(order))
+	selected := make([]FewShotExample, k)
+	for i := range k {
+		selected[k-1-i] = s.examples[order[i]]
+	}
+	return selected, nil
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"agent/embedding/embeddingtest"
+	"agent/llm"
+)
+
+func TestFewShotExamplesAreRoleMessages(t *testing.T) {
+	model := newFakeChatModel(textResponse("ok"), textResponse("ok"))
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("get_weather"))
+	a.AddExamples(FewShotExample{
+		Input:     "Weather in Oslo?",
+		ToolCalls: []ExampleToolCall{{Name: "get_weather", Arguments: `{"location":"Oslo"}`, Result: "rain, 8°C"}},
+		Output:    "Rainy and 8°C in Oslo.",
+	})
+
+	if _, err := a.Invoke(context.Background(), "Weather in Rome?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	msgs := model.Requests()[0].Messages
+	if len(msgs) != 6 {
+		t.Fatalf("got %d messages, want system, 4 example messages and the query: %+v", len(msgs), msgs)
+	}
+	if msgs[1].Role != llm.RoleUser || msgs[1].Content != "Weather in Oslo?" {
+		t.Fatalf("unexpected example input: %+v", msgs[1])
+	}
+	call := msgs[2].ToolCalls
+	if msgs[2].Role != llm.RoleAssistant || len(call) != 1 || call[0].Name != "get_weather" {
+		t.Fatalf("unexpected example tool call: %+v", msgs[2])
+	}
+	if msgs[3].Role != llm.RoleTool || msgs[3].ToolCallID != call[0].ID || msgs[3].Content != "rain, 8°C" {
+		t.Fatalf("unexpected example tool result: %+v", msgs[3])
+	}
+	if msgs[4].Role != llm.RoleAssistant || msgs[5].Content != "Weather in Rome?" {
+		t.Fatalf("unexpected tail: %+v %+v", msgs[4], msgs[5])
+	}
+
+	// Examples are part of the prompt, not of the conversation.
+	if _, err := a.Invoke(context.Background(), "And in Paris?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if n := a.Conversation().Len(); n != 4 {
+		t.Fatalf("conversation has %d messages, want 4", n)
+	}
+}
+
+func TestSimilarityExampleSelector(t *testing.T) {
+	ctx := context.Background()
+	selector, err := NewSimilarityExampleSelector(ctx, embeddingtest.NewKeywordEmbedder("weather", "time", "search"), 2,
+		FewShotExample{Input: "What time is it?", Output: "time"},
+		FewShotExample{Input: "Weather in Oslo? Is the weather nice?", Output: "weather"},
+		FewShotExample{Input: "Search the web for weather news", Output: "search"},
+	)
+	if err != nil {
+		t.Fatalf("NewSimilarityExampleSelector: %v", err)
+	}
+
+	selected, err := selector.Select(ctx, "How is the weather today?")
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if len(selected) != 2 || selected[0].Output != "search" || selected[1].Output != "weather" {
+		t.Fatalf("selected %+v, want the search example then the weather example", selected)
+	}
+
+	model := newFakeChatModel(textResponse("ok"))
+	a := NewAgent(model, false)
+	a.SetExampleSelector(selector)
+	if _, err := a.Invoke(ctx, "what time is it in Tokyo?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	msgs := model.Requests()[0].Messages
+	if got := msgs[len(msgs)-2]; got.Role != llm.RoleAssistant || got.Content != "time" {
+		t.Fatalf("closest example should come right before the query: %+v", msgs)
+	}
+}
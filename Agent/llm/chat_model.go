@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a provider-neutral chat message.
+type Message struct {
+	Role       string        `json:"role"`                   // 角色：system, user, assistant, tool
+	Content    string        `json:"content"`                // 消息内容
+	Name       string        `json:"name,omitempty"`         // Function/tool name (for tool role)
+	ToolCallID string        `json:"tool_call_id,omitempty"` // Tool call ID (for tool role)
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // Tool calls (for assistant role)
+	Parts      []ContentPart `json:"parts,omitempty"`        // Images and files sent after Content (for user role)
+	Synthetic  bool          `json:"synthetic,omitempty"`    // Written by the agent, not the user; never starts a turn (for user role)
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolDefinition describes a tool the model may call.
+type ToolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// Usage reports token consumption of a single completion.
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	CachedTokens     int64 `json:"cached_tokens"` // part of PromptTokens served from the prompt cache
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+	}
+}
+
+// Request is a single chat completion request.
+type Request struct {
+	Messages    []Message
+	Tools       []ToolDefinition
+	Temperature float32
+	// Stop ends the completion before any of these sequences.
+	Stop []string
+	// ResponseFormat asks for a reply matching a JSON Schema. Models that
+	// do not implement StructuredOutputModel ignore it.
+	ResponseFormat *ResponseFormat
+}
+
+// ResponseFormat constrains the reply to JSON matching Schema.
+type ResponseFormat struct {
+	Name   string
+	Schema map[string]any
+	Strict bool
+}
+
+// Response is the model's reply to a Request.
+type Response struct {
+	Message      Message
+	Usage        Usage
+	Model        string
+	FinishReason string
+}
+
+// Delta is an incremental piece of a streamed response.
+type Delta struct {
+	Content string
+}
+
+// StreamFunc is called for each delta while a response is streamed.
+type StreamFunc func(Delta)
+
+// ChatModel is implemented by every LLM backend the agent can talk to.
+type ChatModel interface {
+	// Chat returns the complete response for req.
+	Chat(ctx context.Context, req Request) (*Response, error)
+
+	// ChatStream streams the response to onDelta and returns it assembled,
+	// including tool calls whose fragments arrived across chunks.
+	ChatStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error)
+
+	// ModelName returns the model identifier used for requests
+	ModelName() string
+}
+
+// StructuredOutputModel is implemented by models that can enforce
+// Request.ResponseFormat natively.
+type StructuredOutputModel interface {
+	SupportsResponseFormat() bool
+}
+
+// OverflowFallbackModel is implemented by models that retry a prompt too
+// long for one model's context window on other models.
+type OverflowFallbackModel interface {
+	// OverflowModelNames returns the models such a prompt is tried on.
+	OverflowModelNames() []string
+}
+
+// SupportsResponseFormat reports whether m enforces Request.ResponseFormat.
+func SupportsResponseFormat(m ChatModel) bool {
+	s, ok := m.(StructuredOutputModel)
+	return ok && s.SupportsResponseFormat()
+}
@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ContentPartType string
+
+const (
+	PartText  ContentPartType = "text"
+	PartImage ContentPartType = "image_url"
+	PartFile  ContentPartType = "file"
+)
+
+// ContentPart is a non-text or additional text piece of a message. Images
+// are sent as URLs, usually data URLs; files carry their data as a data URL.
+type ContentPart struct {
+	Type     ContentPartType `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL string          `json:"image_url,omitempty"`
+	FileName string          `json:"file_name,omitempty"`
+	FileData string          `json:"file_data,omitempty"`
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PartText, Text: text}
+}
+
+// ImageURLPart references an image by http(s) or data URL.
+func ImageURLPart(url string) ContentPart {
+	return ContentPart{Type: PartImage, ImageURL: url}
+}
+
+// ImageBytesPart embeds image data as a data URL. An empty mimeType is
+// sniffed from data.
+func ImageBytesPart(data []byte, mimeType string) ContentPart {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return ImageURLPart(DataURL(mimeType, data))
+}
+
+// FileBytesPart attaches a document such as a PDF.
+func FileBytesPart(name string, data []byte, mimeType string) ContentPart {
+	if mimeType == "" {
+		mimeType = detectMimeType(name, data)
+	}
+	return ContentPart{Type: PartFile, FileName: name, FileData: DataURL(mimeType, data)}
+}
+
+// PartFromPath reads a local file and returns an image part for images and
+// a file part for anything else.
+func PartFromPath(path string) (ContentPart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("read attachment: %w", err)
+	}
+	mimeType := detectMimeType(path, data)
+	if strings.HasPrefix(mimeType, "image/") {
+		return ImageBytesPart(data, mimeType), nil
+	}
+	return FileBytesPart(filepath.Base(path), data, mimeType), nil
+}
+
+// DataURL encodes data as a base64 data URL.
+func DataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func detectMimeType(name string, data []byte) string {
+	if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); byExt != "" {
+		mimeType, _, _ := strings.Cut(byExt, ";")
+		return mimeType
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return mimeType
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartFromPath(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "shot.png")
+	pdf := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pdf, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	part, err := PartFromPath(png)
+	if err != nil {
+		t.Fatalf("PartFromPath(png): %v", err)
+	}
+	if part.Type != PartImage || !strings.HasPrefix(part.ImageURL, "data:image/png;base64,") {
+		t.Fatalf("unexpected image part: %+v", part)
+	}
+	part, err = PartFromPath(pdf)
+	if err != nil {
+		t.Fatalf("PartFromPath(pdf): %v", err)
+	}
+	if part.Type != PartFile || part.FileName != "report.pdf" || !strings.HasPrefix(part.FileData, "data:application/pdf;base64,") {
+		t.Fatalf("unexpected file part: %+v", part)
+	}
+	if _, err := PartFromPath(filepath.Join(dir, "missing.png")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
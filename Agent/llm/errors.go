@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorKind classifies a failed chat call.
+type ErrorKind string
+
+const (
+	ErrorAuth          ErrorKind = "auth"           // bad or missing credentials, no access to the model
+	ErrorRateLimit     ErrorKind = "rate_limit"     // 429, retry later
+	ErrorQuota         ErrorKind = "quota"          // account out of credit, retrying will not help
+	ErrorContextLength ErrorKind = "context_length" // prompt does not fit the model's context window
+	ErrorBadRequest    ErrorKind = "bad_request"    // the request itself was rejected
+	ErrorServer        ErrorKind = "server"         // 5xx from the provider
+	ErrorTimeout       ErrorKind = "timeout"        // the request timed out
+	ErrorConnection    ErrorKind = "connection"     // the provider could not be reached
+	ErrorUnknown       ErrorKind = "unknown"
+)
+
+// Sentinels for errors.Is; an *Error matches the sentinel of its kind.
+var (
+	ErrAuth          = errors.New("llm: authentication failed")
+	ErrRateLimit     = errors.New("llm: rate limited")
+	ErrQuota         = errors.New("llm: quota exceeded")
+	ErrContextLength = errors.New("llm: context length exceeded")
+	ErrBadRequest    = errors.New("llm: bad request")
+	ErrServer        = errors.New("llm: server error")
+	ErrTimeout       = errors.New("llm: timeout")
+	ErrConnection    = errors.New("llm: connection failed")
+)
+
+var kindSentinels = map[ErrorKind]error{
+	ErrorAuth:          ErrAuth,
+	ErrorRateLimit:     ErrRateLimit,
+	ErrorQuota:         ErrQuota,
+	ErrorContextLength: ErrContextLength,
+	ErrorBadRequest:    ErrBadRequest,
+	ErrorServer:        ErrServer,
+	ErrorTimeout:       ErrTimeout,
+	ErrorConnection:    ErrConnection,
+}
+
+// ParseErrorKind converts a configured kind name such as "rate_limit".
+func ParseErrorKind(name string) (ErrorKind, error) {
+	kind := ErrorKind(name)
+	if _, ok := kindSentinels[kind]; !ok {
+		return "", fmt.Errorf("unknown error kind %q", name)
+	}
+	return kind, nil
+}
+
+// Error is a classified provider error. Adapters return it so callers can
+// tell failures apart without knowing the provider's SDK.
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int           // HTTP status, 0 when no response was received
+	RetryAfter time.Duration // provider hint, 0 when absent
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s (%d): %v", e.Kind, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	sentinel, ok := kindSentinels[e.Kind]
+	return ok && target == sentinel
+}
+
+// Retryable reports whether the same request may succeed later.
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrorRateLimit, ErrorServer, ErrorTimeout, ErrorConnection:
+		return true
+	}
+	return false
+}
+
+// KindOf returns the kind of the first *Error in err's chain, or
+// ErrorUnknown.
+func KindOf(err error) ErrorKind {
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		return llmErr.Kind
+	}
+	return ErrorUnknown
+}
+
+// IsRetryable reports whether err is a classified error worth retrying.
+func IsRetryable(err error) bool {
+	var llmErr *Error
+	return errors.As(err, &llmErr) && llmErr.Retryable()
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultFallbackErrors are the error kinds that move a FallbackChatModel
+// on to its next entry when an entry does not set OnErrors.
+var DefaultFallbackErrors = []ErrorKind{
+	ErrorRateLimit, ErrorQuota, ErrorServer, ErrorTimeout, ErrorConnection, ErrorContextLength,
+}
+
+// FallbackEntry is one model of a fallback chain together with the rules
+// for leaving it.
+type FallbackEntry struct {
+	Model ChatModel
+	// OnErrors lists the error kinds that move on to the next entry; nil
+	// uses DefaultFallbackErrors. Include ErrorContextLength and put a
+	// larger-context model next to recover from context overflow.
+	OnErrors []ErrorKind
+	// Latency moves on, whatever OnErrors says, when no answer (or, when
+	// streaming, no first delta) has arrived in time. 0 waits as long as
+	// ctx allows. It is not applied to the last entry.
+	Latency time.Duration
+}
+
+func (e FallbackEntry) fallsBackOn(kind ErrorKind) bool {
+	if e.OnErrors == nil {
+		return slices.Contains(DefaultFallbackErrors, kind)
+	}
+	return slices.Contains(e.OnErrors, kind)
+}
+
+// FallbackChatModel tries its entries in order until one answers. The
+// answering model is reported in Response.Model. A stream that has already
+// emitted deltas is never switched to another model.
+type FallbackChatModel struct {
+	entries []FallbackEntry
+}
+
+func NewFallbackChatModel(primary FallbackEntry, fallbacks ...FallbackEntry) *FallbackChatModel {
+	return &FallbackChatModel{entries: append([]FallbackEntry{primary}, fallbacks...)}
+}
+
+// ModelName returns the name of the primary model.
+func (m *FallbackChatModel) ModelName() string {
+	return m.entries[0].Model.ModelName()
+}
+
+// OverflowModelNames returns the primary model and each next entry as long
+// as the previous one falls back on ErrorContextLength.
+func (m *FallbackChatModel) OverflowModelNames() []string {
+	names := []string{m.entries[0].Model.ModelName()}
+	for i := 1; i < len(m.entries) && m.entries[i-1].fallsBackOn(ErrorContextLength); i++ {
+		names = append(names, m.entries[i].Model.ModelName())
+	}
+	return names
+}
+
+// SupportsResponseFormat reports whether every entry enforces
+// Request.ResponseFormat.
+func (m *FallbackChatModel) SupportsResponseFormat() bool {
+	for _, entry := range m.entries {
+		if !SupportsResponseFormat(entry.Model) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *FallbackChatModel) Chat(ctx context.Context, req Request) (*Response, error) {
+	return m.call(ctx, req, nil, false)
+}
+
+func (m *FallbackChatModel) ChatStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	return m.call(ctx, req, onDelta, true)
+}
+
+func (m *FallbackChatModel) call(ctx context.Context, req Request, onDelta StreamFunc, stream bool) (*Response, error) {
+	for i, entry := range m.entries {
+		last := i == len(m.entries)-1
+		resp, streamed, slow, err := callEntry(ctx, entry, req, onDelta, stream, !last)
+		if err == nil {
+			if resp.Model == "" {
+				resp.Model = entry.Model.ModelName()
+			}
+			return resp, nil
+		}
+		if last || streamed || ctx.Err() != nil || !slow && !entry.fallsBackOn(KindOf(err)) {
+			return nil, err
+		}
+		log.Printf("model %s failed, falling back to %s: %v", entry.Model.ModelName(), m.entries[i+1].Model.ModelName(), err)
+	}
+	return nil, fmt.Errorf("no models configured")
+}
+
+// callEntry runs one attempt, cancelling it when the entry's latency
+// threshold passes before the first sign of an answer. It reports whether
+// deltas were streamed and whether the attempt was cut off as too slow.
+func callEntry(ctx context.Context, entry FallbackEntry, req Request, onDelta StreamFunc, stream, enforceLatency bool) (*Response, bool, bool, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var started, slow atomic.Bool
+	if enforceLatency && entry.Latency > 0 {
+		timer := time.AfterFunc(entry.Latency, func() {
+			if !started.Load() {
+				slow.Store(true)
+				cancel()
+			}
+		})
+		defer timer.Stop()
+	}
+	var resp *Response
+	var err error
+	if stream {
+		resp, err = entry.Model.ChatStream(attemptCtx, req, func(d Delta) {
+			started.Store(true)
+			if onDelta != nil {
+				onDelta(d)
+			}
+		})
+	} else {
+		resp, err = entry.Model.Chat(attemptCtx, req)
+	}
+	tooSlow := err != nil && slow.Load() && ctx.Err() == nil
+	if tooSlow {
+		err = &Error{Kind: ErrorTimeout, Err: fmt.Errorf("no answer within %v: %w", entry.Latency, err)}
+	}
+	return resp, started.Load(), tooSlow, err
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubModel answers after delay, or fails with err.
+type stubModel struct {
+	name  string
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (m *stubModel) Chat(ctx context.Context, _ Request) (*Response, error) {
+	m.calls++
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &Response{Message: Message{Role: RoleAssistant, Content: "from " + m.name}}, nil
+}
+
+func (m *stubModel) ChatStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	return m.Chat(ctx, req)
+}
+
+func (m *stubModel) ModelName() string {
+	return m.name
+}
+
+func TestFallbackChatModel(t *testing.T) {
+	overflow := &Error{Kind: ErrorContextLength, StatusCode: 400, Err: errors.New("too long")}
+	tests := []struct {
+		name      string
+		primary   FallbackEntry
+		wantModel string
+		wantErr   error
+	}{
+		{
+			name:      "context overflow moves to larger model",
+			primary:   FallbackEntry{Model: &stubModel{name: "small", err: overflow}},
+			wantModel: "large",
+		},
+		{
+			name:    "unlisted error is returned",
+			primary: FallbackEntry{Model: &stubModel{name: "small", err: overflow}, OnErrors: []ErrorKind{ErrorServer}},
+			wantErr: ErrContextLength,
+		},
+		{
+			name:      "slow primary is abandoned",
+			primary:   FallbackEntry{Model: &stubModel{name: "slow", delay: time.Second}, Latency: 10 * time.Millisecond},
+			wantModel: "large",
+		},
+		{
+			name:      "primary answers",
+			primary:   FallbackEntry{Model: &stubModel{name: "small"}},
+			wantModel: "small",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewFallbackChatModel(tt.primary, FallbackEntry{Model: &stubModel{name: "large"}})
+			resp, err := m.Chat(context.Background(), Request{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			if resp.Model != tt.wantModel {
+				t.Fatalf("answered by %q, want %q", resp.Model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestFallbackOverflowModelNames(t *testing.T) {
+	m := NewFallbackChatModel(
+		FallbackEntry{Model: &stubModel{name: "small"}},
+		FallbackEntry{Model: &stubModel{name: "medium"}, OnErrors: []ErrorKind{ErrorServer}},
+		FallbackEntry{Model: &stubModel{name: "large"}},
+	)
+	names := m.OverflowModelNames()
+	if len(names) != 2 || names[0] != "small" || names[1] != "medium" {
+		t.Fatalf("OverflowModelNames = %v", names)
+	}
+}
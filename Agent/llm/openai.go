@@ -0,0 +1,281 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// OpenAIChatModel adapts the OpenAI chat completions API (and compatible
+// endpoints) to ChatModel. The SDK's own retries are disabled; errors are
+// returned as *Error and retried by the caller's RetryPolicy.
+type OpenAIChatModel struct {
+	client openai.Client
+	model  string
+}
+
+func NewOpenAIChatModel(apiKey string, baseURL string, model string) *OpenAIChatModel {
+	options := []option.RequestOption{option.WithAPIKey(apiKey), option.WithMaxRetries(0)}
+	if baseURL != "" {
+		options = append(options, option.WithBaseURL(baseURL))
+	}
+	return &OpenAIChatModel{
+		client: openai.NewClient(options...),
+		model:  model,
+	}
+}
+
+// ModelName returns the model name
+func (m *OpenAIChatModel) ModelName() string {
+	return m.model
+}
+
+// SupportsResponseFormat reports that json_schema response formats are
+// sent to the API.
+func (m *OpenAIChatModel) SupportsResponseFormat() bool {
+	return true
+}
+
+func (m *OpenAIChatModel) Chat(ctx context.Context, req Request) (*Response, error) {
+	resp, err := m.client.Chat.Completions.New(ctx, m.buildParams(req))
+	if err != nil {
+		return nil, classifyError(ctx, err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("empty response")
+	}
+	return &Response{
+		Message:      fromOpenAIMessage(resp.Choices[0].Message),
+		Usage:        fromOpenAIUsage(resp.Usage),
+		Model:        resp.Model,
+		FinishReason: resp.Choices[0].FinishReason,
+	}, nil
+}
+
+func (m *OpenAIChatModel) ChatStream(ctx context.Context, req Request, onDelta StreamFunc) (*Response, error) {
+	params := m.buildParams(req)
+	params.StreamOptions.IncludeUsage = openai.Bool(true)
+	stream := m.client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+	// The accumulator stitches tool-call names and argument fragments back
+	// together by index across chunks. It only sums the top-level token
+	// counts, so cached tokens are tracked separately.
+	acc := openai.ChatCompletionAccumulator{}
+	var cachedTokens int64
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		cachedTokens += chunk.Usage.PromptTokensDetails.CachedTokens
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" && onDelta != nil {
+			onDelta(Delta{Content: chunk.Choices[0].Delta.Content})
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, classifyError(ctx, err)
+	}
+	if len(acc.Choices) == 0 {
+		return nil, fmt.Errorf("empty stream")
+	}
+	usage := fromOpenAIUsage(acc.Usage)
+	usage.CachedTokens = cachedTokens
+	return &Response{
+		Message:      fromOpenAIMessage(acc.Choices[0].Message),
+		Usage:        usage,
+		Model:        acc.Model,
+		FinishReason: acc.Choices[0].FinishReason,
+	}, nil
+}
+
+func (m *OpenAIChatModel) buildParams(req Request) openai.ChatCompletionNewParams {
+	params := openai.ChatCompletionNewParams{
+		Model:    m.model,
+		Messages: toOpenAIMessages(req.Messages),
+	}
+	params.Temperature = openai.Float(float64(req.Temperature))
+	if len(req.Tools) > 0 {
+		params.Tools = toOpenAITools(req.Tools)
+	}
+	if len(req.Stop) > 0 {
+		params.Stop.OfStringArray = req.Stop
+	}
+	if rf := req.ResponseFormat; rf != nil {
+		jsonSchema := openai.ResponseFormatJSONSchemaJSONSchemaParam{Name: rf.Name, Schema: rf.Schema}
+		if rf.Strict {
+			jsonSchema.Strict = openai.Bool(true)
+		}
+		params.ResponseFormat.OfJSONSchema = &openai.ResponseFormatJSONSchemaParam{JSONSchema: jsonSchema}
+	}
+	return params
+}
+
+func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessageParamUnion {
+	out := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			out = append(out, openai.SystemMessage(msg.Content))
+		case RoleUser:
+			if len(msg.Parts) == 0 {
+				out = append(out, openai.UserMessage(msg.Content))
+				continue
+			}
+			out = append(out, openai.UserMessage(toOpenAIParts(msg.Content, msg.Parts)))
+		case RoleTool:
+			out = append(out, openai.ToolMessage(msg.Content, msg.ToolCallID))
+		case RoleAssistant:
+			asst := openai.ChatCompletionAssistantMessageParam{}
+			if msg.Content != "" {
+				asst.Content.OfString = openai.String(msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				asst.ToolCalls = append(asst.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+					ID: call.ID,
+					Function: openai.ChatCompletionMessageToolCallFunctionParam{
+						Name:      call.Name,
+						Arguments: call.Arguments,
+					},
+				})
+			}
+			out = append(out, openai.ChatCompletionMessageParamUnion{OfAssistant: &asst})
+		}
+	}
+	return out
+}
+
+func toOpenAIParts(text string, parts []ContentPart) []openai.ChatCompletionContentPartUnionParam {
+	out := make([]openai.ChatCompletionContentPartUnionParam, 0, len(parts)+1)
+	if text != "" {
+		out = append(out, openai.TextContentPart(text))
+	}
+	for _, part := range parts {
+		switch part.Type {
+		case PartText:
+			out = append(out, openai.TextContentPart(part.Text))
+		case PartImage:
+			out = append(out, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: part.ImageURL}))
+		case PartFile:
+			file := openai.ChatCompletionContentPartFileFileParam{FileData: openai.String(part.FileData)}
+			if part.FileName != "" {
+				file.Filename = openai.String(part.FileName)
+			}
+			out = append(out, openai.FileContentPart(file))
+		}
+	}
+	return out
+}
+
+func toOpenAITools(defs []ToolDefinition) []openai.ChatCompletionToolParam {
+	out := make([]openai.ChatCompletionToolParam, 0, len(defs))
+	for _, def := range defs {
+		functionDef := openai.FunctionDefinitionParam{
+			Name: def.Name,
+		}
+		if def.Description != "" {
+			functionDef.Description = openai.String(def.Description)
+		}
+		if def.Parameters != nil {
+			functionDef.Parameters = openai.FunctionParameters(def.Parameters)
+		}
+		out = append(out, openai.ChatCompletionToolParam{Function: functionDef})
+	}
+	return out
+}
+
+func fromOpenAIMessage(msg openai.ChatCompletionMessage) Message {
+	out := Message{
+		Role:    RoleAssistant,
+		Content: msg.Content,
+	}
+	for _, call := range msg.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return out
+}
+
+func fromOpenAIUsage(usage openai.CompletionUsage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		CachedTokens:     usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+// classifyError turns SDK and transport errors into *Error. Errors caused
+// by ctx itself are returned unchanged.
+func classifyError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		out := &Error{Kind: ErrorUnknown, StatusCode: apiErr.StatusCode, Err: err}
+		if apiErr.Response != nil {
+			out.RetryAfter = retryAfter(apiErr.Response.Header)
+		}
+		switch status := apiErr.StatusCode; {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			out.Kind = ErrorAuth
+		case status == http.StatusTooManyRequests && apiErr.Code == "insufficient_quota":
+			out.Kind = ErrorQuota
+		case status == http.StatusTooManyRequests:
+			out.Kind = ErrorRateLimit
+		case status == http.StatusRequestTimeout:
+			out.Kind = ErrorTimeout
+		case isContextLengthError(apiErr):
+			out.Kind = ErrorContextLength
+		case status >= 500:
+			out.Kind = ErrorServer
+		case status >= 400:
+			out.Kind = ErrorBadRequest
+		}
+		return out
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrorTimeout, Err: err}
+	}
+	if netErr != nil {
+		return &Error{Kind: ErrorConnection, Err: err}
+	}
+	return err
+}
+
+func isContextLengthError(apiErr *openai.Error) bool {
+	if apiErr.Code == "context_length_exceeded" {
+		return true
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "context length") || strings.Contains(msg, "context window") ||
+		strings.Contains(msg, "maximum context")
+}
+
+// retryAfter reads the retry-after-ms or Retry-After response headers.
+func retryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
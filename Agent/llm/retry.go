@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed chat call is retried.
+// Only retryable errors (see Error.Retryable) are retried, with
+// exponential backoff from BaseDelay capped at MaxDelay. A Retry-After
+// hint from the provider replaces the computed delay; when it is longer
+// than MaxDelay the call is not retried.
+type RetryPolicy struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // total attempts including the first, <= 1 disables retries
+	BaseDelay   time.Duration `mapstructure:"base_delay"`
+	MaxDelay    time.Duration `mapstructure:"max_delay"`
+	Jitter      float64       `mapstructure:"jitter"` // fraction of each delay that is randomized, 0..1
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    20 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Delay returns how long to wait before the attempt after attempt
+// (1-based) failed with err, and false when it should not be retried.
+func (p RetryPolicy) Delay(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	var llmErr *Error
+	if !errors.As(err, &llmErr) || !llmErr.Retryable() {
+		return 0, false
+	}
+	if llmErr.RetryAfter > 0 {
+		if p.MaxDelay > 0 && llmErr.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		return llmErr.RetryAfter, true
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(float64(delay) * min(p.Jitter, 1) * rand.Float64())
+	}
+	return delay, true
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+	server := &Error{Kind: ErrorServer, Err: errors.New("boom")}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 3 * time.Second} {
+		if got, ok := p.Delay(attempt, server); !ok || got != want {
+			t.Errorf("Delay(%d) = %v, %v; want %v", attempt, got, ok, want)
+		}
+	}
+	if _, ok := p.Delay(4, server); ok {
+		t.Error("retried past MaxAttempts")
+	}
+	if _, ok := p.Delay(1, &Error{Kind: ErrorContextLength, Err: errors.New("too long")}); ok {
+		t.Error("retried a fatal error")
+	}
+	hinted := &Error{Kind: ErrorRateLimit, RetryAfter: 1500 * time.Millisecond, Err: errors.New("429")}
+	if got, ok := p.Delay(1, hinted); !ok || got != 1500*time.Millisecond {
+		t.Errorf("Retry-After not honored: %v, %v", got, ok)
+	}
+	hinted.RetryAfter = time.Minute
+	if _, ok := p.Delay(1, hinted); ok {
+		t.Error("retried although Retry-After exceeds MaxDelay")
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if got, _ := p.Delay(2, server); got < time.Second || got > 2*time.Second {
+			t.Fatalf("jittered delay %v out of range", got)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "2")
+	tests := []struct {
+		name string
+		err  *openai.Error
+		want error
+	}{
+		{"auth", &openai.Error{StatusCode: 401}, ErrAuth},
+		{"rate limit", &openai.Error{StatusCode: 429, Response: &http.Response{Header: header}}, ErrRateLimit},
+		{"quota", &openai.Error{StatusCode: 429, Code: "insufficient_quota"}, ErrQuota},
+		{"context length", &openai.Error{StatusCode: 400, Code: "context_length_exceeded"}, ErrContextLength},
+		{"bad request", &openai.Error{StatusCode: 400}, ErrBadRequest},
+		{"server", &openai.Error{StatusCode: 503}, ErrServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(context.Background(), tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("classified as %s, want %v", KindOf(err), tt.want)
+			}
+		})
+	}
+	err := classifyError(context.Background(), tests[1].err)
+	var llmErr *Error
+	if !errors.As(err, &llmErr) || llmErr.RetryAfter != 2*time.Second {
+		t.Fatalf("Retry-After not read: %+v", llmErr)
+	}
+}
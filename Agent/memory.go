@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"agent/memory"
+)
+
+// DefaultMemoryTopK is how many memories are recalled per invocation.
+const DefaultMemoryTopK = 5
+
+// AddMemory remembers a fact. With a MemoryStore it is stored there and
+// only recalled when relevant; otherwise it is part of every system prompt.
+func (a *Agent) AddMemory(text string) {
+	if a.MemoryStore == nil {
+		a.promptWrapper.AddMemory(text)
+		return
+	}
+	if _, err := a.Remember(context.Background(), memory.Memory{Text: text, Source: a.Name}); err != nil {
+		log.Printf("add memory: %v", err)
+	}
+}
+
+// Remember writes m to the MemoryStore and returns its ID.
+func (a *Agent) Remember(ctx context.Context, m memory.Memory) (string, error) {
+	if a.MemoryStore == nil {
+		return "", fmt.Errorf("agent has no memory store")
+	}
+	ids, err := a.MemoryStore.Add(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// Forget deletes memories from the MemoryStore.
+func (a *Agent) Forget(ctx context.Context, ids ...string) error {
+	if a.MemoryStore == nil {
+		return fmt.Errorf("agent has no memory store")
+	}
+	return a.MemoryStore.Delete(ctx, ids...)
+}
+
+// recall adds the memories relevant to query to the wrapper's memory
+// section. A failing store is logged rather than failing the invocation.
+func (a *Agent) recall(ctx context.Context, wrapper *PromptWrapper, query string) []memory.Match {
+	if a.MemoryStore == nil {
+		return nil
+	}
+	k := a.MemoryTopK
+	if k <= 0 {
+		k = DefaultMemoryTopK
+	}
+	matches, err := a.MemoryStore.Search(ctx, query, k)
+	if err != nil {
+		log.Printf("recall memories: %v", err)
+		return nil
+	}
+	// The wrapper is a copy of the agent's; do not append into the
+	// agent's backing array.
+	wrapper.Memory = slices.Clip(wrapper.Memory)
+	for _, m := range matches {
+		wrapper.AddMemory(formatMemory(m.Memory))
+	}
+	return matches
+}
+
+func formatMemory(m memory.Memory) string {
+	text := "- " + m.Text
+	switch {
+	case m.Source != "" && !m.CreatedAt.IsZero():
+		text += fmt.Sprintf(" (%s, %s)", m.Source, m.CreatedAt.Format("2006-01-02"))
+	case !m.CreatedAt.IsZero():
+		text += fmt.Sprintf(" (%s)", m.CreatedAt.Format("2006-01-02"))
+	}
+	return text
+}
@@ -0,0 +1,233 @@
+// Package memory provides long-term memory for agents: memories are
+// embedded when written and recalled by similarity to the query.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/embedding"
+)
+
+// ErrNotFound is returned by Delete for unknown IDs.
+var ErrNotFound = errors.New("memory not found")
+
+// Memory is one remembered fact with its metadata.
+type Memory struct {
+	ID         string    `json:"id"`
+	Text       string    `json:"text"`
+	Source     string    `json:"source,omitempty"` // who or what wrote it, e.g. "user" or a tool name
+	Importance float64   `json:"importance"`       // 0 (trivial) to 1 (essential)
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Match is a memory returned by Search with its relevance score.
+type Match struct {
+	Memory
+	Score float64 `json:"score"`
+}
+
+// Store keeps memories and finds the ones relevant to a query.
+type Store interface {
+	// Add stores memories and returns their IDs. Missing IDs are
+	// generated, missing timestamps set to now; an existing ID is
+	// replaced.
+	Add(ctx context.Context, memories ...Memory) ([]string, error)
+	// Search returns up to k memories, most relevant first.
+	Search(ctx context.Context, query string, k int) ([]Match, error)
+	// Delete removes memories by ID.
+	Delete(ctx context.Context, ids ...string) error
+	// List returns every memory, oldest first.
+	List(ctx context.Context) ([]Memory, error)
+}
+
+type entry struct {
+	Memory
+	Vector []float32 `json:"vector"`
+}
+
+// VectorStore is an in-process Store that ranks memories by the cosine
+// similarity of their embeddings to the query.
+type VectorStore struct {
+	// Pool, when set, embeds batches of memories through
+	// BatchEmbedWithPool, e.g. embedding.NewBatchEmbedder(pool).
+	Pool embedding.EmbedderPooler
+	// MinScore drops matches scoring below it.
+	MinScore float64
+	// ImportanceWeight adds Importance*ImportanceWeight to the similarity,
+	// so important memories win close calls. 0 ranks by similarity only.
+	ImportanceWeight float64
+
+	embedder embedding.Embedder
+	mu       sync.RWMutex
+	entries  []entry
+	nextID   int
+	now      func() time.Time
+}
+
+// NewVectorStore creates an empty store that embeds with embedder.
+func NewVectorStore(embedder embedding.Embedder) *VectorStore {
+	return &VectorStore{embedder: embedder, now: time.Now}
+}
+
+func (s *VectorStore) Add(ctx context.Context, memories ...Memory) ([]string, error) {
+	if len(memories) == 0 {
+		return nil, nil
+	}
+	texts := make([]string, len(memories))
+	for i, m := range memories {
+		if m.Text == "" {
+			return nil, fmt.Errorf("memory %d has no text", i)
+		}
+		texts[i] = m.Text
+	}
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embed memories: %w", err)
+	}
+	if len(vectors) != len(memories) {
+		return nil, fmt.Errorf("embed memories: got %d vectors for %d memories", len(vectors), len(memories))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(memories))
+	for i, m := range memories {
+		if m.ID == "" {
+			s.nextID++
+			m.ID = "mem_" + strconv.Itoa(s.nextID)
+		}
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = s.now()
+		}
+		e := entry{Memory: m, Vector: vectors[i]}
+		if at := s.index(m.ID); at >= 0 {
+			s.entries[at] = e
+		} else {
+			s.entries = append(s.entries, e)
+		}
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
+
+func (s *VectorStore) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	switch {
+	case len(texts) == 1:
+		vector, err := s.embedder.Embed(ctx, texts[0])
+		if err != nil {
+			return nil, err
+		}
+		return [][]float32{vector}, nil
+	case s.Pool != nil:
+		return s.Pool.BatchEmbedWithPool(ctx, s.embedder, texts)
+	default:
+		return s.embedder.BatchEmbed(ctx, texts)
+	}
+}
+
+func (s *VectorStore) Search(ctx context.Context, query string, k int) ([]Match, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	s.mu.RLock()
+	empty := len(s.entries) == 0
+	s.mu.RUnlock()
+	if empty {
+		return nil, nil
+	}
+	vector, err := s.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	matches := make([]Match, 0, len(s.entries))
+	for _, e := range s.entries {
+		score := embedding.CosineSimilarity(vector, e.Vector) + s.ImportanceWeight*e.Importance
+		if score < s.MinScore {
+			continue
+		}
+		matches = append(matches, Match{Memory: e.Memory, Score: score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+func (s *VectorStore) Delete(_ context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var missing []string
+	for _, id := range ids {
+		at := s.index(id)
+		if at < 0 {
+			missing = append(missing, id)
+			continue
+		}
+		s.entries = append(s.entries[:at], s.entries[at+1:]...)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v", ErrNotFound, missing)
+	}
+	return nil
+}
+
+func (s *VectorStore) List(context.Context) ([]Memory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Memory, len(s.entries))
+	for i, e := range s.entries {
+		out[i] = e.Memory
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *VectorStore) index(id string) int {
+	for i, e := range s.entries {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Save writes the memories and their embeddings as JSON.
+func (s *VectorStore) Save(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.NewEncoder(w).Encode(s.entries)
+}
+
+// Load replaces the contents with memories written by Save. The vectors
+// must come from the same embedding model.
+func (s *VectorStore) Load(r io.Reader) error {
+	var entries []entry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return fmt.Errorf("load memories: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	s.nextID = 0
+	for _, e := range entries {
+		if num, ok := strings.CutPrefix(e.ID, "mem_"); ok {
+			if n, err := strconv.Atoi(num); err == nil && n > s.nextID {
+				s.nextID = n
+			}
+		}
+	}
+	return nil
+}
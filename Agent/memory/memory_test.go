@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"agent/embedding/embeddingtest"
+)
+
+func newTestStore() (*VectorStore, *embeddingtest.KeywordEmbedder) {
+	embedder := embeddingtest.NewKeywordEmbedder("coffee", "tea", "paris", "berlin")
+	s := NewVectorStore(embedder)
+	s.now = func() time.Time { return time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC) }
+	return s, embedder
+}
+
+func TestVectorStoreSearch(t *testing.T) {
+	ctx := context.Background()
+	s, embedder := newTestStore()
+	s.Pool = embedder
+	ids, err := s.Add(ctx,
+		Memory{Text: "The user drinks coffee, never tea.", Source: "user"},
+		Memory{Text: "The user lives in Paris.", Importance: 0.2},
+		Memory{Text: "The user was born in Paris.", Importance: 1},
+	)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "mem_1" || embedder.Batches() != 1 {
+		t.Fatalf("ids = %v, batches = %d", ids, embedder.Batches())
+	}
+
+	matches, err := s.Search(ctx, "Best coffee near me?", 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "mem_1" || matches[0].Source != "user" || matches[0].CreatedAt.IsZero() {
+		t.Fatalf("matches = %+v", matches)
+	}
+
+	// Both Paris memories are equally similar; importance breaks the tie.
+	s.ImportanceWeight = 0.1
+	matches, _ = s.Search(ctx, "things to do in paris", 3)
+	if len(matches) < 2 || matches[0].ID != "mem_3" || matches[1].ID != "mem_2" {
+		t.Fatalf("importance not used in ranking: %+v", matches)
+	}
+	s.MinScore = 0.5
+	if matches, _ = s.Search(ctx, "tea", 3); len(matches) != 1 {
+		t.Fatalf("MinScore not applied: %+v", matches)
+	}
+}
+
+func TestVectorStoreDeleteSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore()
+	ids, _ := s.Add(ctx, Memory{Text: "coffee"}, Memory{Text: "tea"})
+	if err := s.Delete(ctx, ids[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(ctx, ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, _ := newTestStore()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	memories, _ := loaded.List(ctx)
+	if len(memories) != 1 || memories[0].Text != "tea" {
+		t.Fatalf("loaded %+v", memories)
+	}
+	if matches, _ := loaded.Search(ctx, "green tea", 1); len(matches) != 1 || matches[0].ID != "mem_2" {
+		t.Fatalf("vectors not restored: %+v", matches)
+	}
+	ids, _ = loaded.Add(ctx, Memory{Text: "paris"})
+	if ids[0] != "mem_3" {
+		t.Fatalf("new ID %s collides with loaded ones", ids[0])
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"agent/embedding/embeddingtest"
+	"agent/memory"
+)
+
+func TestInvokeRecallsRelevantMemories(t *testing.T) {
+	store := memory.NewVectorStore(embeddingtest.NewKeywordEmbedder("weather", "coffee", "paris"))
+	model := newFakeChatModel(textResponse("ok"), textResponse("ok"))
+	a := NewAgent(model, false)
+	a.MemoryStore = store
+	a.MemoryTopK = 1
+	a.AddMemory("The user likes their coffee black.")
+	a.AddMemory("The user lives in Paris.")
+	id, err := a.Remember(context.Background(), memory.Memory{Text: "The user checks the weather every morning.", Source: "user", Importance: 0.5})
+	if err != nil {
+		t.Fatalf("Remember: %v", err)
+	}
+
+	result, err := a.InvokeWithResult(context.Background(), "Is the weather nice today? What weather is expected in Paris?")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	system := model.Requests()[0].Messages[0].Content
+	if !strings.Contains(system, "Memory:\n- The user checks the weather every morning. (user, ") {
+		t.Fatalf("relevant memory missing from the prompt:\n%s", system)
+	}
+	if strings.Contains(system, "coffee") || strings.Contains(system, "lives in Paris") {
+		t.Fatalf("more than MemoryTopK memories injected:\n%s", system)
+	}
+	if len(result.Memories) != 1 || result.Memories[0].ID != id {
+		t.Fatalf("result.Memories = %+v", result.Memories)
+	}
+
+	if err := a.Forget(context.Background(), id); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if _, err := a.Invoke(context.Background(), "Is the weather nice today? What weather is expected in Paris?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if system := model.Requests()[1].Messages[0].Content; !strings.Contains(system, "The user lives in Paris.") {
+		t.Fatalf("next best memory not recalled after Forget:\n%s", system)
+	}
+}
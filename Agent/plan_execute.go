@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+const (
+	DefaultPlannerSystemPrompt string = "You plan multi-step tasks for an assistant that can use tools, and review its progress. Keep plans short; every step must be concrete and self-contained."
+	DefaultMaxPlanSteps        int    = 10
+	// planResultChars bounds how much of a step result the replanner sees.
+	planResultChars = 4000
+)
+
+// ErrPlanStepLimit is the StopReason of a plan that still had steps left
+// after MaxSteps steps.
+var ErrPlanStepLimit = errors.New("plan step limit reached")
+
+// PlanStepResult is the outcome of one executed step.
+type PlanStepResult struct {
+	Step   string      `json:"step"`
+	Result string      `json:"result"`
+	Error  string      `json:"error,omitempty"` // set when the step gave up, e.g. at the loop limit
+	Trace  []TraceStep `json:"trace,omitempty"`
+}
+
+// PlanResult is the outcome of PlanExecuteAgent.InvokePlan. The embedded
+// InvokeResult holds the answer and the usage of every planner and
+// executor call.
+type PlanResult struct {
+	InvokeResult
+	Plan      []string         `json:"plan"`                // the first plan
+	Steps     []PlanStepResult `json:"steps"`               // executed steps in order
+	Remaining []string         `json:"remaining,omitempty"` // steps left when MaxSteps was reached
+	Replans   int              `json:"replans"`
+}
+
+type planOutput struct {
+	Steps []string `json:"steps" required:"true" description:"The steps in order."`
+}
+
+type replanOutput struct {
+	Steps    []string `json:"steps" required:"true" description:"The steps that still need to be done, in order. Empty when the objective is met."`
+	Response string   `json:"response" description:"The final answer for the user, when no steps are left."`
+}
+
+// PlanExecuteAgent answers multi-step tasks in three roles: the Planner
+// writes a step list, the Executor carries out one step at a time with its
+// tools, and the Planner revises the remaining steps after every result.
+// Register tools and set limits on the two agents, but invoke them only
+// through the PlanExecuteAgent.
+type PlanExecuteAgent struct {
+	Executor *Agent
+	Planner  *Agent
+	// MaxSteps bounds how many steps are executed per objective.
+	MaxSteps int
+}
+
+// NewPlanExecuteAgent creates a plan-and-execute agent that uses model for
+// planning and execution. Replace Planner to plan with another model.
+func NewPlanExecuteAgent(model llm.ChatModel) *PlanExecuteAgent {
+	planner := NewAgent(model, false)
+	planner.SetName("Planner")
+	planner.SetSystemPrompt(DefaultPlannerSystemPrompt)
+	return &PlanExecuteAgent{
+		Executor: NewAgent(model, true),
+		Planner:  planner,
+		MaxSteps: DefaultMaxPlanSteps,
+	}
+}
+
+// Conversation returns the objectives and answers of earlier invocations.
+func (p *PlanExecuteAgent) Conversation() *Conversation {
+	return p.Executor.Conversation()
+}
+
+// ResetConversation clears the objectives and answers.
+func (p *PlanExecuteAgent) ResetConversation() {
+	p.Executor.ResetConversation()
+}
+
+// Usage returns the totals of the planner and the executor.
+func (p *PlanExecuteAgent) Usage() UsageStats {
+	return p.Planner.Usage().Add(p.Executor.Usage())
+}
+
+// Invoke plans and carries out userQuery and returns the final answer.
+func (p *PlanExecuteAgent) Invoke(ctx context.Context, userQuery string) (string, error) {
+	result, err := p.InvokePlan(ctx, userQuery)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// InvokePlan plans and carries out objective, returning the plan and the
+// outcome of every step along with the answer. The objective and the
+// answer are recorded in the agent's conversation, which the planner and
+// the executor see on later objectives. All calls count against the
+// Executor's SessionBudget.
+func (p *PlanExecuteAgent) InvokePlan(ctx context.Context, objective string) (*PlanResult, error) {
+	session := p.Executor.Conversation()
+	session.sessionBudget().SetBudget(p.Executor.SessionBudget)
+	history := session.Messages()
+
+	result := &PlanResult{}
+	var plan planOutput
+	planned, err := p.Planner.invokeStructured(ctx, session.branch(history...), planPrompt(objective), tools.SchemaFor[planOutput](), &plan)
+	if err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+	result.add(planned)
+	result.Plan = plan.Steps
+
+	// The executor keeps one conversation per objective, so later steps
+	// can use what earlier ones found.
+	work := session.branch(history...)
+	remaining := plan.Steps
+	for len(remaining) > 0 {
+		if len(result.Steps) >= p.MaxSteps {
+			result.Remaining = remaining
+			result.Partial = true
+			result.StopReason = ErrPlanStepLimit
+			break
+		}
+		step := remaining[0]
+		outcome, err := p.executeStep(ctx, work, objective, result, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("step %d %q: %w", len(result.Steps)+1, step, err)
+		}
+		result.Steps = append(result.Steps, outcome)
+
+		var next replanOutput
+		replanned, err := p.Planner.invokeStructured(ctx, session.branch(history...), replanPrompt(objective, result, remaining[1:]), tools.SchemaFor[replanOutput](), &next)
+		if err != nil {
+			return nil, fmt.Errorf("replan: %w", err)
+		}
+		result.add(replanned)
+		result.Replans++
+		if len(next.Steps) == 0 && strings.TrimSpace(next.Response) != "" {
+			result.Content = next.Response
+			p.record(objective, result.Content)
+			return result, nil
+		}
+		remaining = next.Steps
+	}
+
+	// Out of steps without an answer: write one from the step results.
+	answered, err := p.Planner.InvokeConversation(ctx, session.branch(history...), answerPrompt(objective, result))
+	if err != nil {
+		return nil, fmt.Errorf("answer: %w", err)
+	}
+	result.add(answered)
+	result.Content = answered.Content
+	p.record(objective, result.Content)
+	return result, nil
+}
+
+// executeStep runs the first remaining step on the executor. A step that
+// hits the loop limit is reported to the replanner, not returned.
+func (p *PlanExecuteAgent) executeStep(ctx context.Context, work *Conversation, objective string, result *PlanResult, remaining []string) (PlanStepResult, error) {
+	outcome := PlanStepResult{Step: remaining[0]}
+	done, err := p.Executor.InvokeConversation(ctx, work, stepPrompt(objective, remaining))
+	var limitErr *LoopLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		result.add(&InvokeResult{Usage: limitErr.Usage, Cost: limitErr.Cost})
+		outcome.Error = err.Error()
+		return outcome, nil
+	case err != nil:
+		return outcome, err
+	}
+	result.add(done)
+	outcome.Result = done.Content
+	outcome.Trace = done.Trace
+	if done.Partial {
+		outcome.Error = done.StopReason.Error()
+	}
+	return outcome, nil
+}
+
+// add counts the usage of one planner or executor call.
+func (r *PlanResult) add(next *InvokeResult) {
+	if next.Model != "" {
+		r.Model = next.Model
+	}
+	r.Usage = r.Usage.Add(next.Usage)
+	r.Cost += next.Cost
+	r.Trace = append(r.Trace, next.Trace...)
+}
+
+func (p *PlanExecuteAgent) record(objective, answer string) {
+	p.Executor.Conversation().Append(
+		Message{Role: llm.RoleUser, Content: objective},
+		Message{Role: llm.RoleAssistant, Content: answer},
+	)
+}
+
+func planPrompt(objective string) string {
+	return "Objective: " + objective + "\n\nWrite a step-by-step plan to reach the objective. The result of the last step should answer it."
+}
+
+func stepPrompt(objective string, remaining []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Objective: %s\n\nRemaining plan:\n", objective)
+	writeSteps(&b, remaining)
+	fmt.Fprintf(&b, "\nCarry out only step 1: %s\nReport what you found or did.", remaining[0])
+	return b.String()
+}
+
+func replanPrompt(objective string, result *PlanResult, remaining []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Objective: %s\n\nOriginal plan:\n", objective)
+	writeSteps(&b, result.Plan)
+	b.WriteString("\nCompleted steps:\n")
+	writeOutcomes(&b, result.Steps)
+	b.WriteString("\nSteps still planned:\n")
+	if len(remaining) == 0 {
+		b.WriteString("(none)\n")
+	}
+	writeSteps(&b, remaining)
+	b.WriteString("\nUpdate the plan. List only the steps that still need to be done, changing them if the results call for it. If the objective is met, list no steps and give the final answer for the user in response.")
+	return b.String()
+}
+
+func answerPrompt(objective string, result *PlanResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Objective: %s\n\nCompleted steps:\n", objective)
+	writeOutcomes(&b, result.Steps)
+	b.WriteString("\nUsing these results, give the final answer for the user. Say clearly if anything is missing.")
+	return b.String()
+}
+
+func writeSteps(b *strings.Builder, steps []string) {
+	for i, step := range steps {
+		fmt.Fprintf(b, "%d. %s\n", i+1, step)
+	}
+}
+
+func writeOutcomes(b *strings.Builder, steps []PlanStepResult) {
+	for i, s := range steps {
+		fmt.Fprintf(b, "%d. %s\n", i+1, s.Step)
+		if s.Error != "" {
+			fmt.Fprintf(b, "   Failed: %s\n", s.Error)
+		}
+		if s.Result != "" {
+			fmt.Fprintf(b, "   Result: %s\n", truncateText(s.Result, planResultChars))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"agent/llm"
+)
+
+func TestPlanExecuteReplansAfterEachStep(t *testing.T) {
+	model := newFakeChatModel(
+		textResponse(`{"steps":["Look up the weather in Paris","Compare it with Oslo"]}`),
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{"city":"Paris"}`}),
+		textResponse("Paris: sunny"),
+		textResponse(`{"steps":["Look up the weather in Oslo"]}`),
+		textResponse("Oslo: rain"),
+		textResponse(`{"steps":[],"response":"Paris is sunnier than Oslo."}`),
+	)
+	p := NewPlanExecuteAgent(model)
+	p.Executor.RegisterTool(echoTool("echo"))
+
+	result, err := p.InvokePlan(context.Background(), "Is Paris sunnier than Oslo?")
+	if err != nil {
+		t.Fatalf("InvokePlan: %v", err)
+	}
+	if result.Content != "Paris is sunnier than Oslo." {
+		t.Fatalf("answer = %q", result.Content)
+	}
+	if len(result.Plan) != 2 || result.Replans != 2 || len(result.Steps) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if s := result.Steps[0]; s.Result != "Paris: sunny" || len(s.Trace) != 2 || s.Trace[0].Tool != "echo" {
+		t.Fatalf("unexpected first step: %+v", s)
+	}
+	if s := result.Steps[1]; s.Step != "Look up the weather in Oslo" || s.Result != "Oslo: rain" {
+		t.Fatalf("replanned step not executed: %+v", s)
+	}
+
+	reqs := model.Requests()
+	if len(reqs[0].Tools) != 0 || len(reqs[1].Tools) != 1 {
+		t.Fatal("only the executor should be offered tools")
+	}
+	if replan := reqs[3].Messages[len(reqs[3].Messages)-1].Content; !strings.Contains(replan, "Result: Paris: sunny") {
+		t.Fatalf("step result missing from replan prompt:\n%s", replan)
+	}
+	// The second step sees what the first one found.
+	if got := len(reqs[4].Messages); got < 5 {
+		t.Fatalf("executor history not kept between steps: %d messages", got)
+	}
+	if msgs := p.Conversation().Messages(); len(msgs) != 2 || msgs[1].Content != result.Content {
+		t.Fatalf("conversation = %+v", msgs)
+	}
+}
+
+func TestPlanExecuteStepLimit(t *testing.T) {
+	model := newFakeChatModel(
+		textResponse(`{"steps":["a","b","c"]}`),
+		textResponse("did a"),
+		textResponse(`{"steps":["b","c"]}`),
+		textResponse("Only a is done."),
+	)
+	p := NewPlanExecuteAgent(model)
+	p.MaxSteps = 1
+
+	result, err := p.InvokePlan(context.Background(), "do a, b and c")
+	if err != nil {
+		t.Fatalf("InvokePlan: %v", err)
+	}
+	if !result.Partial || !errors.Is(result.StopReason, ErrPlanStepLimit) {
+		t.Fatalf("partial = %v, stop reason = %v", result.Partial, result.StopReason)
+	}
+	if result.Content != "Only a is done." || len(result.Remaining) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestPlanExecuteCountsUsageOfStepAtLoopLimit(t *testing.T) {
+	looping := toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`})
+	looping.Usage = llm.Usage{PromptTokens: 90, CompletionTokens: 10, TotalTokens: 100}
+	model := newFakeChatModel(
+		textResponse(`{"steps":["loop"]}`),
+		looping,
+		textResponse(`{"steps":[],"response":"Gave up."}`),
+	)
+	p := NewPlanExecuteAgent(model)
+	p.Executor.Maxcircle = 1
+	p.Executor.RegisterTool(echoTool("echo"))
+
+	result, err := p.InvokePlan(context.Background(), "loop forever")
+	if err != nil {
+		t.Fatalf("InvokePlan: %v", err)
+	}
+	if result.Steps[0].Error == "" || result.Usage.TotalTokens != 100 {
+		t.Fatalf("step = %+v, usage = %+v", result.Steps[0], result.Usage)
+	}
+	if result.Model != "fake-model" {
+		t.Fatalf("model = %q", result.Model)
+	}
+}
+
+func TestPlanExecuteKeepsSessionAcrossObjectives(t *testing.T) {
+	counted := func(content string) llm.Response {
+		resp := textResponse(content)
+		resp.Usage = llm.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}
+		return resp
+	}
+	model := newFakeChatModel(
+		counted(`{"steps":["Look up the weather in Paris"]}`),
+		counted("Paris: sunny"),
+		counted(`{"steps":[],"response":"It is sunny in Paris."}`),
+		counted(`{"steps":["Look up the weather in Oslo"]}`),
+		counted("Oslo: rain"),
+		counted(`{"steps":[],"response":"Oslo is rainier."}`),
+	)
+	p := NewPlanExecuteAgent(model)
+	p.Executor.SessionBudget = Budget{MaxTokens: 1000}
+
+	if _, err := p.Invoke(context.Background(), "What is the weather in Paris?"); err != nil {
+		t.Fatalf("first Invoke: %v", err)
+	}
+	if _, err := p.Invoke(context.Background(), "And how does Oslo compare?"); err != nil {
+		t.Fatalf("second Invoke: %v", err)
+	}
+	reqs := model.Requests()
+	for _, i := range []int{3, 4} {
+		if !requestContains(reqs[i], "It is sunny in Paris.") {
+			t.Fatalf("request %d does not see the earlier objective: %+v", i, reqs[i].Messages)
+		}
+	}
+	if spent := p.Conversation().BudgetSpent(); spent.Tokens != 60 {
+		t.Fatalf("session spent %d tokens, want 60", spent.Tokens)
+	}
+}
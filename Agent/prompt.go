@@ -1,20 +1,29 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	"github.com/openai/openai-go"
+	"agent/llm"
 )
 
 // PromptWrapper stores prompt segments for system and user messages.
 type PromptWrapper struct {
-	Memory        []string
-	ToolUsage     []string
-	systemPrompts []string
-	userPrompts   []string
+	Memory    []string
+	ToolUsage []string
+	// Header renders the agent header with the "name" and "description"
+	// variables; nil uses DefaultHeaderTemplate.
+	Header          *PromptTemplate
+	systemPrompts   []string
+	systemTemplates []*PromptTemplate
+	userPrompts     []string
+	examples        []FewShotExample
+	exampleSelector ExampleSelector
 }
 
+var defaultHeader = MustParsePromptTemplate("header", DefaultHeaderTemplate)
+
 func DefaultPromptWrapper() PromptWrapper {
 	return PromptWrapper{}
 }
@@ -34,6 +43,41 @@ func (w *PromptWrapper) AddSystemPrompt(prompt string) {
 	w.systemPrompts = append(w.systemPrompts, prompt)
 }
 
+// AddSystemTemplate appends a system prompt segment rendered with the
+// variables of each call.
+func (w *PromptWrapper) AddSystemTemplate(t *PromptTemplate) {
+	if t == nil {
+		return
+	}
+	w.systemTemplates = append(w.systemTemplates, t)
+}
+
+// AddExamples appends few-shot examples that are sent with every request,
+// after the system message.
+func (w *PromptWrapper) AddExamples(examples ...FewShotExample) {
+	w.examples = append(w.examples, examples...)
+}
+
+// SetExampleSelector picks further examples per query, e.g. a
+// SimilarityExampleSelector. They follow the fixed examples.
+func (w *PromptWrapper) SetExampleSelector(selector ExampleSelector) {
+	w.exampleSelector = selector
+}
+
+// ExampleMessages renders the fixed examples and those selected for query
+// as role messages.
+func (w *PromptWrapper) ExampleMessages(ctx context.Context, query string) ([]Message, error) {
+	examples := w.examples
+	if w.exampleSelector != nil {
+		selected, err := w.exampleSelector.Select(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("select examples: %w", err)
+		}
+		examples = append(examples[:len(examples):len(examples)], selected...)
+	}
+	return exampleMessages(examples), nil
+}
+
 // AddUserPrompt appends an extra user-role prompt segment.
 func (w *PromptWrapper) AddUserPrompt(prompt string) {
 	if strings.TrimSpace(prompt) == "" {
@@ -59,10 +103,50 @@ func (w *PromptWrapper) AddToolUsage(toolUsage string) {
 }
 
 // WrapMessages builds chat messages from the stored prompt segments.
-func (w *PromptWrapper) WrapMessages(name, desc string) []openai.ChatCompletionMessageParamUnion {
+func (w *PromptWrapper) WrapMessages(name, desc string) ([]Message, error) {
+	return w.WrapConversation(name, desc, nil)
+}
+
+// WrapConversation builds the system message, the fixed few-shot examples,
+// replays history as role messages and appends the user message for the
+// current turn. Selected examples need a query; see ExampleMessages.
+// Templates are rendered without call variables.
+func (w *PromptWrapper) WrapConversation(name, desc string, history []Message) ([]Message, error) {
+	messages := make([]Message, 0, len(history)+2)
+	msg, ok, err := w.RenderSystemMessage(name, desc, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		messages = append(messages, msg)
+	}
+	messages = append(messages, exampleMessages(w.examples)...)
+	messages = append(messages, history...)
+	if msg, ok := w.UserMessage(); ok {
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// RenderSystemMessage joins the agent header, memory, tool usage and system
+// prompt segments into one system message. Templates are rendered with
+// vars plus the agent's "name" and "description".
+func (w *PromptWrapper) RenderSystemMessage(name, desc string, vars Vars) (Message, bool, error) {
+	data := Vars{"name": name, "description": desc}
+	for k, v := range vars {
+		data[k] = v
+	}
 	systemParts := make([]string, 0, 8)
-	if name != "" || desc != "" {
-		systemParts = append(systemParts, fmt.Sprintf("Agent Name: %s\nAgent Description: %s", name, desc))
+	header := w.Header
+	if header == nil && (name != "" || desc != "") {
+		header = defaultHeader
+	}
+	if header != nil {
+		text, err := header.Render(data)
+		if err != nil {
+			return Message{}, false, err
+		}
+		systemParts = append(systemParts, text)
 	}
 	if len(w.Memory) > 0 {
 		systemParts = append(systemParts, fmt.Sprintf("Memory:\n%s", strings.Join(w.Memory, "\n")))
@@ -73,20 +157,25 @@ func (w *PromptWrapper) WrapMessages(name, desc string) []openai.ChatCompletionM
 	if len(w.systemPrompts) > 0 {
 		systemParts = append(systemParts, w.systemPrompts...)
 	}
-
-	userParts := make([]string, 0, 4)
-	if len(w.userPrompts) > 0 {
-		userParts = append(userParts, w.userPrompts...)
+	for _, t := range w.systemTemplates {
+		text, err := t.Render(data)
+		if err != nil {
+			return Message{}, false, err
+		}
+		systemParts = append(systemParts, text)
 	}
 	systemMessage := strings.TrimSpace(strings.Join(systemParts, "\n\n"))
-	userMessage := strings.TrimSpace(strings.Join(userParts, "\n\n"))
-
-	messages := make([]openai.ChatCompletionMessageParamUnion, 0, 2)
-	if systemMessage != "" {
-		messages = append(messages, openai.SystemMessage(systemMessage))
+	if systemMessage == "" {
+		return Message{}, false, nil
 	}
-	if userMessage != "" {
-		messages = append(messages, openai.UserMessage(userMessage))
+	return Message{Role: llm.RoleSystem, Content: systemMessage}, true, nil
+}
+
+// UserMessage joins the user prompt segments into one user message.
+func (w *PromptWrapper) UserMessage() (Message, bool) {
+	userMessage := strings.TrimSpace(strings.Join(w.userPrompts, "\n\n"))
+	if userMessage == "" {
+		return Message{}, false
 	}
-	return messages
+	return Message{Role: llm.RoleUser, Content: userMessage}, true
 }
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"context"
+
+	"agent/llm"
 )
 
 // ReActAgent wraps a base Agent with ReAct-style prompting.
@@ -10,13 +12,22 @@ type ReActAgent struct {
 }
 
 // NewReActAgent creates an agent configured for ReAct prompting.
-func NewReActAgent(apiKey string, baseURL string, model string) *ReActAgent {
-	base := NewAgent(apiKey, baseURL, model, true)
+func NewReActAgent(model llm.ChatModel) *ReActAgent {
+	base := NewAgent(model, true)
 	base.SetSystemPrompt(DefaultReActSystemPrompt)
 	base.SetPromptWrapper(ReActPromptWrapper())
 	return &ReActAgent{Agent: base}
 }
 
+// NewReActTextAgent creates a ReAct agent that speaks the text protocol
+// (Thought/Action/Action Input/Observation) instead of native tool calls,
+// for models without a tools API.
+func NewReActTextAgent(model llm.ChatModel) *ReActAgent {
+	r := NewReActAgent(model)
+	r.ToolProtocol = ToolProtocolReAct
+	return r
+}
+
 // Invoke runs the ReAct agent, defaulting to allow tool calls.
 func (r *ReActAgent) Invoke(ctx context.Context, userQuery string) (string, error) {
 	return r.Agent.Invoke(ctx, userQuery)
@@ -28,6 +39,6 @@ type BaseAgent struct {
 }
 
 // NewBaseAgent creates a plain base agent.
-func NewBaseAgent(apiKey string, baseURL string, model string) *BaseAgent {
-	return &BaseAgent{Agent: NewAgent(apiKey, baseURL, model, false)}
+func NewBaseAgent(model llm.ChatModel) *BaseAgent {
+	return &BaseAgent{Agent: NewAgent(model, false)}
 }
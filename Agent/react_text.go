@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+// ToolProtocol selects how tools are offered to the model.
+type ToolProtocol string
+
+const (
+	// ToolProtocolNative uses the provider's tool-calling API.
+	ToolProtocolNative ToolProtocol = "native"
+	// ToolProtocolReAct describes the tools in the prompt and parses
+	// Thought/Action/Action Input blocks from plain-text completions, for
+	// models without a tools API.
+	ToolProtocolReAct ToolProtocol = "react"
+)
+
+// reactStop ends a completion where the model would start inventing the
+// tool's observation.
+var reactStop = []string{"\nObservation:"}
+
+// ErrReActFormat matches errors from ParseReActOutput.
+var ErrReActFormat = errors.New("malformed ReAct output")
+
+// ReActStep is one parsed ReAct completion: either an action to run or the
+// final answer.
+type ReActStep struct {
+	Thought     string
+	Action      string
+	ActionInput string
+	Final       bool
+	FinalAnswer string
+}
+
+var (
+	// reactLabel matches a label at the start of a line, tolerating
+	// Markdown decoration such as "**Action:**" or "- Thought:".
+	reactLabel = regexp.MustCompile(`(?im)^[ \t>*_#-]*(thought|action[ _]?input|action|final[ _]?answer|observation)[ \t*_]*:[ \t*_]*`)
+	// inlineCall matches "search(query)" or "search[query]" in an Action.
+	inlineCall = regexp.MustCompile(`^([\w.-]+)\s*[(\[](.*)[)\]]$`)
+)
+
+// ParseReActOutput parses a plain-text ReAct completion. Anything after an
+// "Observation:" line is ignored. Text without any labels is taken as the
+// final answer. When both an Action and a Final Answer appear, the earlier
+// one wins.
+func ParseReActOutput(text string) (ReActStep, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	matches := reactLabel.FindAllStringSubmatchIndex(text, -1)
+	// Everything from an invented Observation on is dropped.
+	limit := len(text)
+	for i, m := range matches {
+		if normalizeLabel(text[m[2]:m[3]]) == "observation" {
+			limit = m[0]
+			matches = matches[:i]
+			break
+		}
+	}
+	if len(matches) == 0 {
+		answer := strings.TrimSpace(text[:limit])
+		if answer == "" {
+			return ReActStep{}, fmt.Errorf("%w: empty completion", ErrReActFormat)
+		}
+		return ReActStep{Final: true, FinalAnswer: answer}, nil
+	}
+
+	var step ReActStep
+	step.Thought = strings.TrimSpace(text[:matches[0][0]])
+	sections := map[string]string{}
+	var order []string
+	for i, m := range matches {
+		label := normalizeLabel(text[m[2]:m[3]])
+		if _, seen := sections[label]; seen {
+			// A repeated label starts another step; keep the first one.
+			break
+		}
+		end := limit
+		if i+1 < len(matches) && label != "final answer" {
+			end = matches[i+1][0]
+		}
+		sections[label] = strings.TrimSpace(text[m[1]:end])
+		order = append(order, label)
+	}
+	if thought, ok := sections["thought"]; ok {
+		step.Thought = strings.TrimSpace(step.Thought + "\n" + thought)
+	}
+
+	for _, label := range order {
+		switch label {
+		case "final answer":
+			step.Final = true
+			step.FinalAnswer = sections[label]
+			if step.FinalAnswer == "" {
+				return ReActStep{}, fmt.Errorf("%w: Final Answer is empty", ErrReActFormat)
+			}
+			return step, nil
+		case "action":
+			action := stripDecoration(firstLine(sections[label]))
+			input, hasInput := sections["action input"]
+			if m := inlineCall.FindStringSubmatch(action); m != nil && !hasInput {
+				action, input = m[1], m[2]
+			}
+			action = strings.TrimSuffix(action, "()")
+			if action == "" {
+				return ReActStep{}, fmt.Errorf("%w: Action names no tool", ErrReActFormat)
+			}
+			step.Action = action
+			step.ActionInput = stripCodeFence(input)
+			return step, nil
+		}
+	}
+	if _, ok := sections["action input"]; ok {
+		return ReActStep{}, fmt.Errorf("%w: Action Input without an Action", ErrReActFormat)
+	}
+	return ReActStep{}, fmt.Errorf("%w: expected an Action or a Final Answer", ErrReActFormat)
+}
+
+func normalizeLabel(label string) string {
+	label = strings.ToLower(label)
+	label = strings.ReplaceAll(label, "_", " ")
+	switch label {
+	case "actioninput":
+		return "action input"
+	case "finalanswer":
+		return "final answer"
+	}
+	return label
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+func stripDecoration(s string) string {
+	return strings.Trim(strings.TrimSpace(s), "`'\"*_ .:")
+}
+
+func (a *Agent) usesReActText() bool {
+	return a.ToolProtocol == ToolProtocolReAct && a.AllowTools && len(a.tools) > 0
+}
+
+// reactToolPrompt describes the tools and the expected format.
+func (a *Agent) reactToolPrompt() string {
+	names := make([]string, 0, len(a.tools))
+	for name := range a.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("You can use these tools:\n")
+	for _, name := range names {
+		tool := a.tools[name]
+		fmt.Fprintf(&b, "- %s: %s\n", name, tool.Description)
+		if tool.Parameters != nil {
+			if data, err := json.Marshal(tool.Parameters); err == nil {
+				fmt.Fprintf(&b, "  Input schema: %s\n", data)
+			}
+		}
+	}
+	b.WriteString(`
+Use exactly this format:
+
+Thought: what you need to do next
+Action: the tool to use, one of [` + strings.Join(names, ", ") + `]
+Action Input: the tool input as a JSON object
+Observation: the tool result (written for you, never write it yourself)
+... (Thought/Action/Action Input/Observation can repeat)
+Thought: I know the final answer
+Final Answer: the answer to the user
+
+Stop after Action Input and wait for the Observation.`)
+	return b.String()
+}
+
+// parseReActMessage turns a text completion into the internal form used
+// by the tool loop: an action becomes a synthetic tool call with the
+// thought as content, a final answer replaces the content. It also returns
+// the model's thought.
+func (a *Agent) parseReActMessage(msg Message, round int) (Message, string, error) {
+	step, err := ParseReActOutput(msg.Content)
+	if err != nil {
+		return msg, "", err
+	}
+	if step.Final {
+		msg.Content = step.FinalAnswer
+		return msg, step.Thought, nil
+	}
+	input := step.ActionInput
+	if tool, ok := a.tools[step.Action]; ok {
+		input = coerceReActInput(tool, input)
+	}
+	// renderReActMessages writes the Action lines again from the tool
+	// call, so they show the arguments that actually ran.
+	msg.Content = step.Thought
+	msg.ToolCalls = []llm.ToolCall{{
+		ID:        fmt.Sprintf("react_%d", round),
+		Name:      step.Action,
+		Arguments: input,
+	}}
+	return msg, step.Thought, nil
+}
+
+// coerceReActInput wraps a bare value in an object when the tool takes a
+// single property, since models often write `Action Input: Paris`.
+func coerceReActInput(tool tools.Tool, input string) string {
+	input = strings.TrimSpace(input)
+	var obj map[string]any
+	if input == "" || json.Unmarshal([]byte(input), &obj) == nil {
+		return input
+	}
+	properties, _ := tool.Parameters["properties"].(map[string]any)
+	if len(properties) != 1 {
+		return input
+	}
+	for name, raw := range properties {
+		var value any = strings.Trim(input, `"'`)
+		if prop, ok := raw.(map[string]any); ok && prop["type"] != "string" {
+			if json.Unmarshal([]byte(input), &value) != nil {
+				return input
+			}
+		}
+		data, err := json.Marshal(map[string]any{name: value})
+		if err != nil {
+			return input
+		}
+		return string(data)
+	}
+	return input
+}
+
+// reactFormatReminder answers a completion that could not be parsed.
+func reactFormatReminder(err error) Message {
+	return Message{
+		Role:      llm.RoleUser,
+		Synthetic: true,
+		Content:   fmt.Sprintf("Observation: %v. Reply with either \"Action:\" and \"Action Input:\" lines, or a \"Final Answer:\" line.", err),
+	}
+}
+
+// renderReActMessages converts the internal transcript for a model without
+// a tools API: tool calls become Action lines and tool results become
+// Observation messages.
+func renderReActMessages(messages []Message) []Message {
+	out := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		switch {
+		case msg.Role == llm.RoleAssistant && len(msg.ToolCalls) > 0:
+			content := strings.TrimSpace(msg.Content)
+			if !reactLabel.MatchString(content) {
+				// Written by the native protocol, e.g. replayed history.
+				var b strings.Builder
+				if content != "" {
+					fmt.Fprintf(&b, "Thought: %s\n", content)
+				}
+				for _, call := range msg.ToolCalls {
+					fmt.Fprintf(&b, "Action: %s\nAction Input: %s\n", call.Name, call.Arguments)
+				}
+				content = strings.TrimSpace(b.String())
+			}
+			out = append(out, Message{Role: llm.RoleAssistant, Content: content})
+		case msg.Role == llm.RoleTool:
+			out = append(out, Message{Role: llm.RoleUser, Content: "Observation: " + msg.Content})
+		default:
+			out = append(out, msg)
+		}
+	}
+	return out
+}
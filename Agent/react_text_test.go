@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+func TestParseReActOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    ReActStep
+		wantErr bool
+	}{
+		{
+			name: "action",
+			text: "Thought: I need the weather.\nAction: get_weather\nAction Input: {\"location\": \"Paris\"}",
+			want: ReActStep{Thought: "I need the weather.", Action: "get_weather", ActionInput: `{"location": "Paris"}`},
+		},
+		{
+			name: "final answer",
+			text: "Thought: I know it now.\nFinal Answer: It is 21°C\nand sunny.",
+			want: ReActStep{Thought: "I know it now.", Final: true, FinalAnswer: "It is 21°C\nand sunny."},
+		},
+		{
+			name: "markdown decoration and code fence",
+			text: "**Thought:** look it up\n**Action:** `web_search`\n**Action Input:**\n```json\n{\"query\": \"go\"}\n```",
+			want: ReActStep{Thought: "look it up", Action: "web_search", ActionInput: `{"query": "go"}`},
+		},
+		{
+			name: "invented observation is dropped",
+			text: "Action: search\nAction Input: {\"q\":\"x\"}\nObservation: made up\nFinal Answer: wrong",
+			want: ReActStep{Action: "search", ActionInput: `{"q":"x"}`},
+		},
+		{
+			name: "thought without label and lower case labels",
+			text: "I should search.\naction: search\naction_input: golang",
+			want: ReActStep{Thought: "I should search.", Action: "search", ActionInput: "golang"},
+		},
+		{
+			name: "inline call",
+			text: "Action: search[golang generics]",
+			want: ReActStep{Action: "search", ActionInput: "golang generics"},
+		},
+		{
+			name: "earlier final answer wins",
+			text: "Final Answer: 42\nAction: search",
+			want: ReActStep{Final: true, FinalAnswer: "42\nAction: search"},
+		},
+		{
+			name: "plain text is the final answer",
+			text: "Paris is the capital of France.",
+			want: ReActStep{Final: true, FinalAnswer: "Paris is the capital of France."},
+		},
+		{name: "thought only", text: "Thought: hmm", wantErr: true},
+		{name: "empty action", text: "Thought: x\nAction:\nAction Input: {}", wantErr: true},
+		{name: "input without action", text: "Action Input: {}", wantErr: true},
+		{name: "empty final answer", text: "Final Answer:", wantErr: true},
+		{name: "empty", text: "  \n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReActOutput(tt.text)
+			if tt.wantErr {
+				if !errors.Is(err, ErrReActFormat) {
+					t.Fatalf("err = %v, want ErrReActFormat", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseReActOutput: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReActTextProtocolLoop(t *testing.T) {
+	model := newFakeChatModel(
+		textResponse("Thought: check the weather\nAction: get_weather"),
+		textResponse("Thought: check the weather\nAction: get_weather\nAction Input: Paris"),
+		textResponse("Thought: done\nFinal Answer: Sunny in Paris."),
+	)
+	a := NewReActTextAgent(model)
+	a.RegisterTool(tools.New("get_weather", func(_ context.Context, args string) (string, error) {
+		return "sunny " + args, nil
+	}, tools.WithParameters(tools.ObjectSchema(map[string]any{"location": tools.StringProperty("city")}, "location"))))
+
+	reply, err := a.Invoke(context.Background(), "weather in Paris?")
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if reply != "Sunny in Paris." {
+		t.Fatalf("reply = %q", reply)
+	}
+	reqs := model.Requests()
+	if len(reqs[0].Tools) != 0 || len(reqs[0].Stop) == 0 {
+		t.Fatalf("text protocol must not use the tools API: tools=%v stop=%v", reqs[0].Tools, reqs[0].Stop)
+	}
+	if system := reqs[0].Messages[0].Content; !strings.Contains(system, "- get_weather: ") || !strings.Contains(system, "Final Answer:") {
+		t.Fatalf("tools not rendered into the prompt:\n%s", system)
+	}
+	// The first completion lacked an Action Input, which is valid: the
+	// empty input then fails validation and is reported as an observation.
+	for _, msg := range reqs[2].Messages {
+		if msg.Role == llm.RoleTool || len(msg.ToolCalls) > 0 {
+			t.Fatalf("native tool message sent in text mode: %+v", msg)
+		}
+	}
+	last := reqs[2].Messages[len(reqs[2].Messages)-1]
+	if last.Role != llm.RoleUser || last.Content != `Observation: sunny {"location":"Paris"}` {
+		t.Fatalf("unexpected observation: %+v", last)
+	}
+}
+
+func TestReActTextStreamsOnlyTheFinalAnswer(t *testing.T) {
+	model := newFakeChatModel(
+		textResponse("Thought: check the weather\nAction: get_weather\nAction Input: Paris"),
+		textResponse("Thought: done\nFinal Answer: Sunny in Paris."),
+	)
+	a := NewReActTextAgent(model)
+	a.RegisterTool(echoTool("get_weather"))
+
+	var text, reasoning string
+	for ev := range a.InvokeStream(context.Background(), "weather in Paris?") {
+		switch ev.Type {
+		case StreamEventTextDelta:
+			text += ev.Delta
+		case StreamEventReasoning:
+			reasoning += ev.Delta
+		case StreamEventError:
+			t.Fatalf("stream error: %v", ev.Err)
+		}
+	}
+	if text != "Sunny in Paris." {
+		t.Fatalf("streamed text = %q, want only the final answer", text)
+	}
+	if !strings.Contains(reasoning, "Action: get_weather") {
+		t.Fatalf("protocol not streamed as reasoning: %q", reasoning)
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+const (
+	DefaultReflectionRounds int    = 2
+	DefaultCriticPrompt     string = "You review answers written by an assistant that can use tools. Check the draft answer against the user's question and the tool results: it must answer what was asked, agree with the tool results, and not claim anything they do not support. Approve answers that are correct and complete; otherwise say precisely what is wrong or missing and how to fix it."
+	// reflectionTranscriptChars bounds the work shown to the critic.
+	reflectionTranscriptChars = 16000
+)
+
+// Reflection has every draft answer reviewed by a critic before it is
+// returned. A rejected draft is sent back to the agent together with the
+// critique, and the tool loop continues so the agent can revise it, using
+// tools again if needed. Revisions count towards Maxcircle, so a draft
+// written in the last round is returned without review. When streaming, a
+// draft's text is only sent once it is kept.
+type Reflection struct {
+	// Critic reviews the drafts; nil uses the agent's own model.
+	Critic llm.ChatModel
+	// MaxRounds bounds the revisions per invocation; the draft written
+	// after the last revision is returned without another review.
+	MaxRounds int
+	// Prompt instructs the critic; empty uses DefaultCriticPrompt.
+	Prompt string
+}
+
+// critique is the critic's structured verdict.
+type critique struct {
+	Approved bool   `json:"approved" required:"true" description:"True when the draft can be returned as it is."`
+	Problems string `json:"problems" description:"What is wrong or missing and how to fix it; empty when approved."`
+}
+
+func (r *Reflection) maxRounds() int {
+	if r.MaxRounds > 0 {
+		return r.MaxRounds
+	}
+	return DefaultReflectionRounds
+}
+
+// review asks the critic about draft. work holds the turn so far without
+// the draft. A critic that fails or replies in the wrong shape approves
+// the draft, so reflection never costs the user an answer.
+func (a *Agent) review(ctx context.Context, round int, question string, work []Message, draft string, result *InvokeResult, budget budgets) (critique, TraceStep) {
+	r := a.Reflection
+	critic := r.Critic
+	if critic == nil {
+		critic = a.model
+	}
+	prompt := r.Prompt
+	if prompt == "" {
+		prompt = DefaultCriticPrompt
+	}
+	schema := tools.SchemaFor[critique]()
+	req := llm.Request{Temperature: 0}
+	if llm.SupportsResponseFormat(critic) {
+		req.ResponseFormat = &llm.ResponseFormat{Name: "critique", Schema: schema}
+	} else {
+		prompt += "\n\n" + structuredInstructions(schema)
+	}
+	req.Messages = []Message{
+		{Role: llm.RoleSystem, Content: prompt},
+		{Role: llm.RoleUser, Content: fmt.Sprintf("Question:\n%s\n\nWork so far:\n%s\nDraft answer:\n%s",
+			question, truncateText(renderTranscript(work), reflectionTranscriptChars), draft)},
+	}
+
+	approve := critique{Approved: true}
+	start := time.Now()
+	resp, err := a.completeWith(ctx, critic, req, nil)
+	if err != nil {
+		log.Printf("reflection: critic failed, keeping the draft: %v", err)
+		return approve, TraceStep{Round: round, Critique: "critic failed: " + err.Error(), Approved: true}
+	}
+	budget.addUsage(resp.Usage, a.countUsage(result, critic, resp))
+	step := roundTrace(round, "", resp, time.Since(start))
+	var verdict critique
+	if err := decodeStructured(schema, resp.Message.Content, &verdict); err != nil {
+		log.Printf("reflection: unusable critique, keeping the draft: %v", err)
+		step.Critique, step.Approved = resp.Message.Content, true
+		return approve, step
+	}
+	if !verdict.Approved && strings.TrimSpace(verdict.Problems) == "" {
+		verdict.Problems = "The answer was rejected without details; check it against the question and the tool results."
+	}
+	step.Critique, step.Approved = verdict.Problems, verdict.Approved
+	return verdict, step
+}
+
+// revisionRequest sends a rejected draft back to the agent.
+func revisionRequest(c critique) Message {
+	return Message{
+		Role:      llm.RoleUser,
+		Synthetic: true,
+		Content:   "A reviewer found problems with your answer:\n" + c.Problems + "\nRevise the answer. Use tools again if you need more information.",
+	}
+}
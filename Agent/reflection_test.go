@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"agent/llm"
+)
+
+func TestReflectionRevisesRejectedDraft(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{"city":"Paris"}`}),
+		textResponse("It is sunny."),
+		textResponse("It is sunny and 21°C in Paris."),
+	)
+	rejection := textResponse(`{"approved":false,"problems":"The temperature is missing."}`)
+	rejection.Model = "critic-model"
+	rejection.Usage = llm.Usage{PromptTokens: 30, CompletionTokens: 5, TotalTokens: 35}
+	critic := newFakeChatModel(rejection, textResponse(`{"approved":true}`))
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("echo"))
+	a.Reflection = &Reflection{Critic: critic}
+
+	result, err := a.InvokeWithResult(context.Background(), "weather in Paris?")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	if result.Content != "It is sunny and 21°C in Paris." {
+		t.Fatalf("answer = %q", result.Content)
+	}
+	if result.Model != "fake-model" || result.Usage.TotalTokens != 35 {
+		t.Fatalf("model = %q, usage = %+v; want the executor's model and the critic's usage", result.Model, result.Usage)
+	}
+	reviews := critic.Requests()
+	if len(reviews) != 2 {
+		t.Fatalf("got %d reviews, want 2", len(reviews))
+	}
+	if work := reviews[0].Messages[1].Content; !strings.Contains(work, `echo:{"city":"Paris"}`) || !strings.Contains(work, "Draft answer:\nIt is sunny.") {
+		t.Fatalf("critic did not see the tool results and the draft:\n%s", work)
+	}
+	reqs := model.Requests()
+	if last := reqs[2].Messages[len(reqs[2].Messages)-1]; last.Role != llm.RoleUser || !strings.Contains(last.Content, "The temperature is missing.") {
+		t.Fatalf("critique not sent back: %+v", last)
+	}
+
+	var critiques []TraceStep
+	for _, step := range result.Trace {
+		if step.Critique != "" || step.Approved {
+			critiques = append(critiques, step)
+		}
+	}
+	if len(critiques) != 2 || critiques[0].Approved || critiques[0].Critique != "The temperature is missing." || !critiques[1].Approved {
+		t.Fatalf("unexpected critiques in trace: %+v", critiques)
+	}
+}
+
+func TestReflectionStopsAfterMaxRounds(t *testing.T) {
+	model := newFakeChatModel(textResponse("draft 1"), textResponse("draft 2"))
+	critic := newFakeChatModel(textResponse(`{"approved":false,"problems":"Try again."}`))
+	a := NewAgent(model, false)
+	a.Reflection = &Reflection{Critic: critic, MaxRounds: 1}
+
+	reply, err := a.Invoke(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if reply != "draft 2" || len(critic.Requests()) != 1 {
+		t.Fatalf("reply = %q after %d reviews", reply, len(critic.Requests()))
+	}
+}
+
+func TestReflectionKeepsDraftOfLastRound(t *testing.T) {
+	model := newFakeChatModel(textResponse("draft"))
+	critic := newFakeChatModel(textResponse(`{"approved":false,"problems":"Try again."}`))
+	a := NewAgent(model, false)
+	a.Maxcircle = 1
+	a.Reflection = &Reflection{Critic: critic}
+
+	reply, err := a.Invoke(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if reply != "draft" || len(critic.Requests()) != 0 {
+		t.Fatalf("reply = %q after %d reviews", reply, len(critic.Requests()))
+	}
+}
+
+func TestReflectionStreamsOnlyTheKeptAnswer(t *testing.T) {
+	model := newFakeChatModel(textResponse("draft"), textResponse("revised"))
+	critic := newFakeChatModel(
+		textResponse(`{"approved":false,"problems":"Try again."}`),
+		textResponse(`{"approved":true}`),
+	)
+	a := NewAgent(model, false)
+	a.Reflection = &Reflection{Critic: critic}
+
+	var text string
+	for ev := range a.InvokeStream(context.Background(), "hi") {
+		switch ev.Type {
+		case StreamEventTextDelta:
+			text += ev.Delta
+		case StreamEventError:
+			t.Fatalf("stream error: %v", ev.Err)
+		}
+	}
+	if text != "revised" {
+		t.Fatalf("streamed text = %q, want only the revision", text)
+	}
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+
+	"agent/llm"
+)
+
+// StreamEventType identifies the kind of event emitted by InvokeStream.
+type StreamEventType string
+
+const (
+	StreamEventTextDelta  StreamEventType = "text_delta"
+	StreamEventReasoning  StreamEventType = "reasoning"
+	StreamEventToolCall   StreamEventType = "tool_call"
+	StreamEventToolResult StreamEventType = "tool_result"
+	StreamEventFinal      StreamEventType = "final"
+	StreamEventError      StreamEventType = "error"
+)
+
+// StreamEvent is a single typed event produced while an invocation runs.
+type StreamEvent struct {
+	Type       StreamEventType
+	Delta      string        // text fragment (text_delta, reasoning)
+	ToolCallID string        // tool call id (tool_call, tool_result)
+	ToolName   string        // tool name (tool_call, tool_result)
+	Arguments  string        // full tool arguments (tool_call)
+	Result     string        // tool output (tool_result)
+	Content    string        // complete answer (final)
+	Final      *InvokeResult // answer with usage and cost (final)
+	Err        error         // failure cause (error)
+}
+
+// eventSink receives stream events; a nil sink discards them.
+type eventSink func(StreamEvent)
+
+func (s eventSink) send(ev StreamEvent) {
+	if s != nil {
+		s(ev)
+	}
+}
+
+// asReasoning returns a sink that passes text deltas on to sink as
+// reasoning, e.g. the Thought and Action lines of the text ReAct protocol.
+func asReasoning(sink eventSink) eventSink {
+	if sink == nil {
+		return nil
+	}
+	return func(ev StreamEvent) {
+		if ev.Type == StreamEventTextDelta {
+			ev.Type = StreamEventReasoning
+		}
+		sink(ev)
+	}
+}
+
+// deltaBuffer holds back the text deltas of a completion until it is known
+// whether the text is kept, e.g. a draft the critic may still reject.
+type deltaBuffer struct {
+	held []StreamEvent
+}
+
+// wrap returns a sink that buffers text deltas and passes the other events
+// on to sink.
+func (b *deltaBuffer) wrap(sink eventSink) eventSink {
+	if sink == nil {
+		return nil
+	}
+	return func(ev StreamEvent) {
+		if ev.Type == StreamEventTextDelta {
+			b.held = append(b.held, ev)
+			return
+		}
+		sink(ev)
+	}
+}
+
+// flush sends the held deltas to sink.
+func (b *deltaBuffer) flush(sink eventSink) {
+	for _, ev := range b.held {
+		sink.send(ev)
+	}
+	b.held = nil
+}
+
+// InvokeStream runs the same tool loop as Invoke but streams the completion.
+// The returned channel yields text deltas and tool events, then exactly one
+// final or error event before it is closed. Cancel ctx to abandon the stream.
+// With the text ReAct protocol the completions are streamed as reasoning
+// and only the final answer as text.
+func (a *Agent) InvokeStream(ctx context.Context, userQuery string) <-chan StreamEvent {
+	return a.InvokeStreamWithAttachments(ctx, userQuery)
+}
+
+// InvokeStreamWithAttachments is InvokeStream with images or files sent
+// along with userQuery.
+func (a *Agent) InvokeStreamWithAttachments(ctx context.Context, userQuery string, attachments ...llm.ContentPart) <-chan StreamEvent {
+	events := make(chan StreamEvent, 16)
+	go func() {
+		defer close(events)
+		sink := eventSink(func(ev StreamEvent) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		})
+		result, err := a.run(ctx, a.conversation, userQuery, callOptions{attachments: attachments}, sink)
+		if err != nil {
+			sink.send(StreamEvent{Type: StreamEventError, Err: err})
+			return
+		}
+		sink.send(StreamEvent{Type: StreamEventFinal, Content: result.Content, Final: result})
+	}()
+	return events
+}
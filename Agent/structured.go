@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+// StructuredOutputError is returned when the reply still does not match the
+// schema after every re-prompt.
+type StructuredOutputError struct {
+	Attempts int
+	Content  string // the last reply
+	Err      error  // why it was rejected
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("structured output still invalid after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// InvokeTyped answers userQuery with a JSON value decoded into T. The
+// schema is derived from T as for typed tools (see tools.SchemaFor).
+func InvokeTyped[T any](ctx context.Context, a *Agent, userQuery string) (T, *InvokeResult, error) {
+	var out T
+	result, err := a.InvokeStructured(ctx, userQuery, tools.SchemaFor[T](), &out)
+	return out, result, err
+}
+
+// InvokeStructured answers userQuery with JSON matching schema and decodes
+// it into out. Models that support response formats are asked for the
+// schema natively; otherwise the schema is spelled out in the prompt. A
+// reply that does not validate is sent back with the problems found, up
+// to StructuredRetries times.
+func (a *Agent) InvokeStructured(ctx context.Context, userQuery string, schema map[string]any, out any) (*InvokeResult, error) {
+	return a.invokeStructured(ctx, a.conversation, userQuery, schema, out)
+}
+
+// invokeStructured runs the attempts on a branch of conv, so the schema
+// and the re-prompts stay out of it; only the query and the reply that
+// was used are appended to conv.
+func (a *Agent) invokeStructured(ctx context.Context, conv *Conversation, userQuery string, schema map[string]any, out any) (*InvokeResult, error) {
+	opts := callOptions{}
+	query := userQuery
+	// Providers only accept an object at the root of a response format.
+	if llm.SupportsResponseFormat(a.model) && schema["type"] == "object" {
+		opts.responseFormat = &llm.ResponseFormat{Name: "response", Schema: schema}
+	} else {
+		query = userQuery + "\n\n" + structuredInstructions(schema)
+	}
+	if conv.parent == nil {
+		conv.sessionBudget().SetBudget(a.SessionBudget)
+	}
+	work := conv.branch(conv.Messages()...)
+	total := &InvokeResult{}
+	for attempt := 1; ; attempt++ {
+		result, err := a.run(ctx, work, query, opts, nil)
+		if err != nil {
+			return total, err
+		}
+		total.merge(result)
+		err = decodeStructured(schema, result.Content, out)
+		if err == nil {
+			conv.Append(
+				Message{Role: llm.RoleUser, Content: userQuery},
+				Message{Role: llm.RoleAssistant, Content: result.Content},
+			)
+			return total, nil
+		}
+		if attempt > a.StructuredRetries {
+			return total, &StructuredOutputError{Attempts: attempt, Content: result.Content, Err: err}
+		}
+		query = fmt.Sprintf("Your previous reply could not be used: %v\nReply again with only a JSON value that matches the schema, without any other text.", err)
+	}
+}
+
+// merge folds a follow-up invocation into r.
+func (r *InvokeResult) merge(next *InvokeResult) {
+	r.Content = next.Content
+	r.Model = next.Model
+	r.Usage = r.Usage.Add(next.Usage)
+	r.Cost += next.Cost
+	r.Partial = next.Partial
+	r.StopReason = next.StopReason
+	r.Trace = append(r.Trace, next.Trace...)
+}
+
+func structuredInstructions(schema map[string]any) string {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return "Reply with only a JSON value that matches this JSON Schema, without code fences or any other text:\n" + string(data)
+}
+
+// decodeStructured validates content against schema and decodes it into
+// out. A surrounding Markdown code fence is tolerated.
+func decodeStructured(schema map[string]any, content string, out any) error {
+	text := stripCodeFence(content)
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("reply is not valid JSON: %v", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("reply contains more than one JSON value")
+	}
+	if issues := tools.Validate(schema, value); len(issues) > 0 {
+		parts := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			if issue.Path == "" {
+				parts = append(parts, issue.Message)
+				continue
+			}
+			parts = append(parts, issue.Path+": "+issue.Message)
+		}
+		return fmt.Errorf("reply does not match the schema: %s", strings.Join(parts, "; "))
+	}
+	dec = json.NewDecoder(bytes.NewReader([]byte(text)))
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("decode reply: %v", err)
+	}
+	return nil
+}
+
+func stripCodeFence(content string) string {
+	text := strings.TrimSpace(content)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
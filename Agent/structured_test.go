@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"agent/llm"
+)
+
+type forecast struct {
+	City  string `json:"city" required:"true"`
+	TempC int    `json:"temp_c" required:"true" min:"-90" max:"60"`
+}
+
+// nativeFakeChatModel is a fake model that enforces response formats.
+type nativeFakeChatModel struct {
+	*fakeChatModel
+}
+
+func (nativeFakeChatModel) SupportsResponseFormat() bool { return true }
+
+func TestInvokeTypedRepromptsUntilValid(t *testing.T) {
+	model := newFakeChatModel(
+		textResponse("It is sunny in Paris."),
+		textResponse(`{"city":"Paris","temp_c":500}`),
+		textResponse("```json\n{\"city\":\"Paris\",\"temp_c\":21}\n```"),
+	)
+	a := NewAgent(model, false)
+
+	got, result, err := InvokeTyped[forecast](context.Background(), a, "weather in Paris?")
+	if err != nil {
+		t.Fatalf("InvokeTyped: %v", err)
+	}
+	if got != (forecast{City: "Paris", TempC: 21}) {
+		t.Fatalf("decoded %+v", got)
+	}
+	if result.Content == "" {
+		t.Fatal("result has no content")
+	}
+	reqs := model.Requests()
+	if reqs[0].ResponseFormat != nil {
+		t.Fatal("response format sent to a model that does not support it")
+	}
+	if first := reqs[0].Messages[len(reqs[0].Messages)-1].Content; !strings.Contains(first, `"temp_c"`) {
+		t.Fatalf("schema missing from prompt: %q", first)
+	}
+	if reprompt := reqs[2].Messages[len(reqs[2].Messages)-1].Content; !strings.Contains(reprompt, "temp_c: must be <= 60") {
+		t.Fatalf("validation issues missing from re-prompt: %q", reprompt)
+	}
+	history := a.Conversation().Messages()
+	if len(history) != 2 || history[0].Content != "weather in Paris?" || history[1].Content != result.Content {
+		t.Fatalf("only the query and the used reply belong in the conversation: %+v", history)
+	}
+}
+
+func TestInvokeStructuredKeepsUsageOfFailedAttempts(t *testing.T) {
+	invalid := textResponse("It is sunny in Paris.")
+	invalid.Usage = llm.Usage{PromptTokens: 40, CompletionTokens: 10, TotalTokens: 50}
+	model := newFakeChatModel(invalid)
+	a := NewAgent(model, false)
+
+	_, result, err := InvokeTyped[forecast](context.Background(), a, "weather in Paris?")
+	if err == nil {
+		t.Fatal("want the error of the second attempt")
+	}
+	if result == nil || result.Usage.TotalTokens != 50 {
+		t.Fatalf("usage of the first attempt lost: %+v", result)
+	}
+	if n := a.Conversation().Len(); n != 0 {
+		t.Fatalf("failed attempts left %d messages in the conversation", n)
+	}
+}
+
+func TestInvokeTypedNativeFormat(t *testing.T) {
+	model := newFakeChatModel(textResponse(`{"city":"Oslo"}`), textResponse(`{"city":"Oslo"}`))
+	a := NewAgent(nativeFakeChatModel{model}, false)
+	a.StructuredRetries = 1
+
+	_, _, err := InvokeTyped[forecast](context.Background(), a, "weather in Oslo?")
+	var structErr *StructuredOutputError
+	if !errors.As(err, &structErr) || structErr.Attempts != 2 {
+		t.Fatalf("err = %v, want *StructuredOutputError after 2 attempts", err)
+	}
+	rf := model.Requests()[0].ResponseFormat
+	if rf == nil || rf.Schema["type"] != "object" {
+		t.Fatalf("response format not requested: %+v", rf)
+	}
+}
@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultHeaderTemplate renders the agent header of the system message.
+const DefaultHeaderTemplate = "Agent Name: {{.name}}\nAgent Description: {{.description}}"
+
+// Vars are the variables a prompt template is rendered with. Run adds
+// "name" and "description" from the agent; per-call variables win.
+type Vars map[string]any
+
+// VarType is the declared type of a template variable.
+type VarType string
+
+const (
+	VarString VarType = "string"
+	VarInt    VarType = "int"
+	VarFloat  VarType = "float"
+	VarBool   VarType = "bool"
+	VarList   VarType = "list"
+	VarMap    VarType = "map"
+	VarAny    VarType = "any"
+)
+
+// PromptTemplate is a text/template prompt. Referencing a variable that
+// was not supplied is an error, as is a declared variable that is missing
+// or has the wrong type.
+//
+// A template may start with YAML front matter that declares its variables
+// and few-shot examples:
+//
+//	---
+//	vars:
+//	  topic: string
+//	  max_items: int
+//	examples:
+//	  - {input: "Go generics", output: "- type parameters\n- constraints"}
+//	---
+//	List at most {{.max_items}} facts about {{.topic}}.
+//	{{fewshot .examples}}
+//
+// The examples are available as .examples unless the caller passes its own.
+type PromptTemplate struct {
+	Name     string
+	Vars     map[string]VarType
+	Examples []FewShotExample
+	tmpl     *template.Template
+}
+
+type frontMatter struct {
+	Vars     map[string]VarType `yaml:"vars"`
+	Examples []FewShotExample   `yaml:"examples"`
+}
+
+// templateFuncs are available in every template, e.g.
+// {{.tools | join ", "}} or {{fewshot .examples}}.
+var templateFuncs = template.FuncMap{
+	"fewshot": fewShotBlock,
+	"join":    joinList,
+}
+
+func newTemplateSet() *template.Template {
+	return template.New("").Option("missingkey=error").Funcs(templateFuncs)
+}
+
+// ParsePromptTemplate parses a template without partials.
+func ParsePromptTemplate(name, text string) (*PromptTemplate, error) {
+	return parsePromptTemplate(newTemplateSet(), name, text)
+}
+
+// MustParsePromptTemplate is ParsePromptTemplate that panics on error, for
+// templates defined in code.
+func MustParsePromptTemplate(name, text string) *PromptTemplate {
+	t, err := ParsePromptTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parsePromptTemplate(set *template.Template, name, text string) (*PromptTemplate, error) {
+	meta, body, err := splitFrontMatter(text)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+	for v, typ := range meta.Vars {
+		if !typ.valid() {
+			return nil, fmt.Errorf("prompt %s: variable %s has unknown type %q", name, v, typ)
+		}
+	}
+	tmpl, err := set.New(name).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+	return &PromptTemplate{Name: name, Vars: meta.Vars, Examples: meta.Examples, tmpl: tmpl}, nil
+}
+
+func splitFrontMatter(text string) (frontMatter, string, error) {
+	var meta frontMatter
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return meta, text, nil
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		header, ok = strings.CutSuffix(rest, "\n---")
+		if !ok {
+			return meta, "", fmt.Errorf("front matter is not closed with ---")
+		}
+	}
+	if err := yaml.Unmarshal([]byte(header), &meta); err != nil {
+		return meta, "", fmt.Errorf("front matter: %w", err)
+	}
+	return meta, body, nil
+}
+
+// Render executes the template with vars. A declared variable also takes
+// a value whose key differs only in case, since config loaders such as
+// viper lower-case keys.
+func (t *PromptTemplate) Render(vars Vars) (string, error) {
+	data := make(map[string]any, len(vars)+1)
+	if t.Examples != nil {
+		data["examples"] = t.Examples
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+	for name := range t.Vars {
+		if _, ok := data[name]; ok {
+			continue
+		}
+		for k, v := range vars {
+			if strings.EqualFold(k, name) {
+				data[name] = v
+				break
+			}
+		}
+	}
+	if err := t.checkVars(data); err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render prompt %s: %w", t.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func (t *PromptTemplate) checkVars(data map[string]any) error {
+	names := make([]string, 0, len(t.Vars))
+	for name := range t.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := data[name]
+		if !ok {
+			return fmt.Errorf("render prompt %s: missing variable %q", t.Name, name)
+		}
+		if !t.Vars[name].matches(value) {
+			return fmt.Errorf("render prompt %s: variable %q is %T, want %s", t.Name, name, value, t.Vars[name])
+		}
+	}
+	return nil
+}
+
+func (typ VarType) valid() bool {
+	switch typ {
+	case VarString, VarInt, VarFloat, VarBool, VarList, VarMap, VarAny:
+		return true
+	}
+	return false
+}
+
+func (typ VarType) matches(value any) bool {
+	if typ == VarAny {
+		return true
+	}
+	if value == nil {
+		return false
+	}
+	v := reflect.ValueOf(value)
+	switch typ {
+	case VarString:
+		return v.Kind() == reflect.String
+	case VarInt:
+		return v.CanInt() || v.CanUint()
+	case VarFloat:
+		return v.CanFloat() || v.CanInt() || v.CanUint()
+	case VarBool:
+		return v.Kind() == reflect.Bool
+	case VarList:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	case VarMap:
+		return v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+	}
+	return false
+}
+
+// fewShotBlock renders examples as numbered Input/Output pairs, with the
+// tool calls of an example in between.
+func fewShotBlock(examples []FewShotExample) string {
+	var b strings.Builder
+	for i, ex := range examples {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "Example %d:\nInput: %s\n", i+1, ex.Input)
+		for _, call := range ex.ToolCalls {
+			fmt.Fprintf(&b, "Tool call: %s %s\nTool result: %s\n", call.Name, call.Arguments, call.Result)
+		}
+		fmt.Fprintf(&b, "Output: %s", ex.Output)
+	}
+	return b.String()
+}
+
+// joinList joins the elements of any slice with sep.
+func joinList(sep string, list any) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: %T is not a list", list)
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep), nil
+}
+
+// PromptLibrary holds the templates loaded from a prompts directory.
+type PromptLibrary struct {
+	templates map[string]*PromptTemplate
+}
+
+// LoadPromptDir loads every *.tmpl file in dir as a template named after
+// the file. Files in dir/partials are partials: every template can include
+// them with {{template "name" .}}.
+func LoadPromptDir(dir string) (*PromptLibrary, error) {
+	set := newTemplateSet()
+	partials, err := filepath.Glob(filepath.Join(dir, "partials", "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range partials {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := set.New(templateName(path)).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("partial %s: %w", path, err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	lib := &PromptLibrary{templates: make(map[string]*PromptTemplate, len(files))}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// Each prompt gets its own copy of the partials, so {{define}}
+		// blocks in one prompt do not leak into another.
+		own, err := set.Clone()
+		if err != nil {
+			return nil, err
+		}
+		t, err := parsePromptTemplate(own, templateName(path), string(data))
+		if err != nil {
+			return nil, err
+		}
+		lib.templates[t.Name] = t
+	}
+	return lib, nil
+}
+
+func templateName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// Get returns the template called name.
+func (l *PromptLibrary) Get(name string) (*PromptTemplate, error) {
+	t, ok := l.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("prompt %q not found", name)
+	}
+	return t, nil
+}
+
+// Names lists the loaded templates in order.
+func (l *PromptLibrary) Names() []string {
+	names := make([]string, 0, len(l.templates))
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
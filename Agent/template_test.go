@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplateRender(t *testing.T) {
+	tmpl, err := ParsePromptTemplate("research", `---
+vars:
+  topic: string
+  max_items: int
+examples:
+  - {input: "Go", output: "A language."}
+  - {input: "Go 1.22", tool_calls: [{name: search, arguments: "{}", result: "loopvar"}], output: "New loop variables."}
+---
+List {{.max_items}} facts about {{.topic}}.
+{{fewshot .examples}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	got, err := tmpl.Render(Vars{"topic": "Rust", "max_items": 3})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "List 3 facts about Rust.\nExample 1:\nInput: Go\nOutput: A language.\n\n" +
+		"Example 2:\nInput: Go 1.22\nTool call: search {}\nTool result: loopvar\nOutput: New loop variables."
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	errs := map[string]Vars{
+		"missing variable":     {"max_items": 3},
+		"is string, want int":  {"topic": "Rust", "max_items": "3"},
+		"map has no entry for": nil,
+	}
+	for want, vars := range errs {
+		if vars == nil {
+			_, err = MustParsePromptTemplate("undeclared", "Hello {{.who}}").Render(nil)
+		} else {
+			_, err = tmpl.Render(vars)
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want it to contain %q", err, want)
+		}
+	}
+
+	// Keys lower-cased by the config loader fill declared variables.
+	named := MustParsePromptTemplate("greeting", "---\nvars:\n  userName: string\n---\nHello {{.userName}}.")
+	if got, err := named.Render(Vars{"username": "Ada"}); err != nil || got != "Hello Ada." {
+		t.Fatalf("Render = %q, %v", got, err)
+	}
+
+	wrapper := DefaultPromptWrapper()
+	wrapper.AddSystemTemplate(tmpl)
+	if _, err := wrapper.WrapMessages("agent", ""); err == nil {
+		t.Fatal("WrapMessages dropped a template that failed to render")
+	}
+	a := NewAgent(newFakeChatModel(textResponse("never")), false)
+	a.SetSystemTemplate(tmpl)
+	if _, err := a.Invoke(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "missing variable") {
+		t.Fatalf("Invoke err = %v, want the render error", err)
+	}
+}
+
+func TestLoadPromptDirWithPartials(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "partials", "rules.tmpl"), "Always answer in {{.language}}.")
+	writeFile(t, filepath.Join(dir, "researcher.tmpl"), "You research {{.topic}}.\n{{template \"rules\" .}}")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "ignored")
+
+	lib, err := LoadPromptDir(dir)
+	if err != nil {
+		t.Fatalf("LoadPromptDir: %v", err)
+	}
+	if names := lib.Names(); len(names) != 1 || names[0] != "researcher" {
+		t.Fatalf("names = %v", names)
+	}
+	tmpl, err := lib.Get("researcher")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	model := newFakeChatModel(textResponse("ok"), textResponse("ok"))
+	a := NewAgent(model, false)
+	a.SetName("Researcher")
+	a.SetSystemTemplate(tmpl)
+	a.PromptVars = Vars{"language": "English", "topic": "birds"}
+	if _, err := a.InvokeWithVars(context.Background(), "hi", Vars{"topic": "fish"}); err != nil {
+		t.Fatalf("InvokeWithVars: %v", err)
+	}
+	system := model.Requests()[0].Messages[0].Content
+	want := "Agent Name: Researcher\nAgent Description: " + DefaultDescription + "\n\nYou research fish.\nAlways answer in English."
+	if system != want {
+		t.Fatalf("system prompt = %q, want %q", system, want)
+	}
+
+	a.PromptVars = nil
+	if _, err := a.Invoke(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), `no entry for key "topic"`) {
+		t.Fatalf("err = %v, want a missing variable error", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+// Use registers middlewares around every tool call of this agent.
+//
+// Middlewares compose in a fixed order, outermost first: agent-wide ones in
+// registration order, then those added with UseTool, then the tool's own
+// tools.WithMiddleware list, and finally the handler.
+func (a *Agent) Use(middlewares ...tools.Middleware) {
+	a.middlewares = append(a.middlewares, middlewares...)
+}
+
+// UseTool registers middlewares for a single tool of this agent.
+func (a *Agent) UseTool(name string, middlewares ...tools.Middleware) {
+	a.toolMiddlewares[name] = append(a.toolMiddlewares[name], middlewares...)
+}
+
+// toolHandler returns the tool's handler wrapped in its middleware chain.
+func (a *Agent) toolHandler(tool tools.Tool) tools.ToolHandler {
+	chain := make([]tools.Middleware, 0, len(a.middlewares)+len(tool.Middlewares))
+	chain = append(chain, a.middlewares...)
+	chain = append(chain, a.toolMiddlewares[tool.Name]...)
+	chain = append(chain, tool.Middlewares...)
+	return tools.Chain(tool.Handler, chain...)
+}
+
+// SetSerialTools marks tools that must run alone in this agent, in
+// addition to tools registered with tools.WithSerial.
+func (a *Agent) SetSerialTools(names ...string) {
+	for _, name := range names {
+		a.serialTools[name] = struct{}{}
+	}
+}
+
+func (a *Agent) isSerialTool(name string) bool {
+	if _, ok := a.serialTools[name]; ok {
+		return true
+	}
+	tool, ok := a.tools[name]
+	return ok && tool.Serial
+}
+
+// executeToolCalls runs the tool calls of one assistant message and returns
+// their tool messages and run times in the original ToolCalls order.
+// Consecutive calls run concurrently up to MaxParallelTools; a serial tool
+// waits for the calls before it and blocks the ones after it. Calls to
+// unknown tools are resolved by UnknownToolPolicy before anything runs.
+// Arguments edited by the approver are written back into calls.
+func (a *Agent) executeToolCalls(ctx context.Context, calls []llm.ToolCall, sink eventSink) ([]Message, []time.Duration, error) {
+	invocations := make([]toolInvocation, len(calls))
+	for i, call := range calls {
+		inv, err := a.resolveToolCall(call)
+		if err != nil {
+			return nil, nil, err
+		}
+		invocations[i] = inv
+	}
+
+	results := make([]Message, len(calls))
+	latencies := make([]time.Duration, len(calls))
+	run := func(i int) {
+		start := time.Now()
+		results[i] = a.callTool(ctx, &invocations[i], sink)
+		latencies[i] = time.Since(start)
+	}
+	limit := a.MaxParallelTools
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, inv := range invocations {
+		if inv.found && a.isSerialTool(inv.tool.Name) {
+			wg.Wait()
+			run(i)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			run(i)
+		}()
+	}
+	wg.Wait()
+	for i := range invocations {
+		calls[i].Arguments = invocations[i].call.Arguments
+	}
+	return results, latencies, nil
+}
+
+// callTool runs a single resolved tool call and builds its tool message.
+// Arguments edited on approval replace inv.call.Arguments.
+func (a *Agent) callTool(ctx context.Context, inv *toolInvocation, sink eventSink) Message {
+	call := inv.call
+	var result string
+	var parts []llm.ContentPart
+	if inv.found {
+		result, parts, inv.call.Arguments = a.runTool(ctx, inv.tool, call, sink)
+		result = inv.note + result
+	} else {
+		log.Printf("Tool %s not found", call.Name)
+		result = a.unknownToolResult(call.Name)
+	}
+	sink.send(StreamEvent{Type: StreamEventToolResult, ToolCallID: call.ID, ToolName: call.Name, Result: result})
+	return Message{Role: llm.RoleTool, Content: result, ToolCallID: call.ID, Name: call.Name, Parts: parts}
+}
+
+// withToolAttachments moves parts attached by tools (see tools.Attach) into
+// a user message after the tool results, since tool messages carry text
+// only.
+func withToolAttachments(toolMessages []Message) []Message {
+	var parts []llm.ContentPart
+	for i := range toolMessages {
+		if len(toolMessages[i].Parts) == 0 {
+			continue
+		}
+		parts = append(parts, llm.TextPart(fmt.Sprintf("Attached by %s (call %s):", toolMessages[i].Name, toolMessages[i].ToolCallID)))
+		parts = append(parts, toolMessages[i].Parts...)
+		toolMessages[i].Parts = nil
+	}
+	if len(parts) == 0 {
+		return toolMessages
+	}
+	return append(toolMessages, Message{Role: llm.RoleUser, Content: "Attachments returned by the tools above:", Parts: parts, Synthetic: true})
+}
+
+// runTool asks for approval when required, then dispatches the call through
+// the middleware chain. Failures are returned as text for the model. Parts
+// attached by the handler are returned alongside the text, and so are the
+// arguments the call ended up with, which the approver may have edited.
+func (a *Agent) runTool(ctx context.Context, tool tools.Tool, call llm.ToolCall, sink eventSink) (string, []llm.ContentPart, string) {
+	call.Name = tool.Name
+	args, rejection := a.authorizeToolCall(ctx, tool, call)
+	sink.send(StreamEvent{Type: StreamEventToolCall, ToolCallID: call.ID, ToolName: call.Name, Arguments: args})
+	if rejection != "" {
+		return rejection, nil, args
+	}
+	log.Printf("Agent calling tool: %s with args: %s", call.Name, args)
+	ctx = tools.WithCallInfo(ctx, tools.CallInfo{ToolName: call.Name, CallID: call.ID})
+	ctx, attached := tools.WithAttachments(ctx)
+	result, err := a.invokeHandler(ctx, tool, args)
+	switch {
+	case errors.Is(err, tools.ErrToolTimeout):
+		return fmt.Sprintf("Tool %s timed out: %v. It was cancelled and returned no result.", call.Name, err), nil, args
+	case err != nil:
+		result = fmt.Sprintf("Error executing tool: %v", err)
+	}
+	return result, attached(), args
+}
+
+// authorizeToolCall validates the arguments and asks for approval when the
+// tool requires it. It returns the arguments to run with, and the result for
+// the model when the call must not run: invalid arguments or a denial.
+func (a *Agent) authorizeToolCall(ctx context.Context, tool tools.Tool, call llm.ToolCall) (string, string) {
+	args := call.Arguments
+	if err := validateToolArguments(tool, args); err != nil {
+		return args, invalidArgumentsResult(call.Name, err)
+	}
+	if !a.requiresApproval(tool) {
+		return args, ""
+	}
+	decision := a.approve(ctx, ApprovalRequest{ToolName: call.Name, CallID: call.ID, Arguments: args})
+	switch decision.Action {
+	case ApprovalApprove:
+		return args, ""
+	case ApprovalEdit:
+		args = decision.Arguments
+		if err := validateToolArguments(tool, args); err != nil {
+			return args, invalidArgumentsResult(call.Name, err)
+		}
+		return args, ""
+	default:
+		return args, fmt.Sprintf("Tool call denied: %s", decision.Reason)
+	}
+}
+
+// invokeHandler runs the tool's middleware chain under the tool timeout
+// (tool.Timeout, else ToolTimeout). When the deadline passes or ctx is
+// cancelled it returns tools.ErrToolTimeout without waiting; the handler's
+// context is cancelled and its late result is dropped.
+func (a *Agent) invokeHandler(ctx context.Context, tool tools.Tool, args string) (string, error) {
+	timeout := tool.Timeout
+	if timeout <= 0 {
+		timeout = a.ToolTimeout
+	}
+	callCtx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result string
+		err    error
+	}
+	// Buffered so an abandoned handler can still deliver and exit.
+	done := make(chan outcome, 1)
+	handler := a.toolHandler(tool)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("tool panicked: %v", r)}
+			}
+		}()
+		result, err := handler(callCtx, args)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%w: invocation cancelled (%v)", tools.ErrToolTimeout, ctx.Err())
+		}
+		return "", fmt.Errorf("%w after %s", tools.ErrToolTimeout, timeout)
+	}
+}
+
+// validateToolArguments checks args against the tool's declared schema.
+// Tools without Parameters accept anything.
+func validateToolArguments(tool tools.Tool, args string) error {
+	if tool.Parameters == nil {
+		return nil
+	}
+	return tools.ValidateArguments(tool.Parameters, args)
+}
+
+// invalidArgumentsResult renders a schema validation failure as a JSON tool
+// result the model can act on.
+func invalidArgumentsResult(toolName string, err error) string {
+	payload := map[string]any{
+		"error": "invalid_arguments",
+		"tool":  toolName,
+		"hint":  "The handler did not run. Fix the arguments to match the tool's parameter schema and call the tool again.",
+	}
+	var verr *tools.ValidationError
+	if errors.As(err, &verr) {
+		payload["issues"] = verr.Issues
+	} else {
+		payload["message"] = err.Error()
+	}
+	data, mErr := json.Marshal(payload)
+	if mErr != nil {
+		return fmt.Sprintf("Invalid arguments for %s: %v", toolName, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+func TestExecuteToolCallsInParallel(t *testing.T) {
+	var running, peak atomic.Int32
+	slow := func(name string, opts ...tools.Option) tools.Tool {
+		return tools.New(name, func(context.Context, string) (string, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(30 * time.Millisecond)
+			return name, nil
+		}, opts...)
+	}
+	a := NewAgent(newFakeChatModel(), true)
+	a.MaxParallelTools = 2
+	a.RegisterTool(slow("a"))
+	a.RegisterTool(slow("b"))
+	a.RegisterTool(slow("c"))
+	a.RegisterTool(slow("lock", tools.WithSerial()))
+
+	calls := []llm.ToolCall{
+		{ID: "1", Name: "a"},
+		{ID: "2", Name: "b"},
+		{ID: "3", Name: "c"},
+		{ID: "4", Name: "lock"},
+		{ID: "5", Name: "a"},
+	}
+	msgs := runToolCalls(t, a, calls)
+	if len(msgs) != len(calls) {
+		t.Fatalf("got %d tool messages, want %d", len(msgs), len(calls))
+	}
+	for i, msg := range msgs {
+		if msg.ToolCallID != calls[i].ID || msg.Content != calls[i].Name {
+			t.Fatalf("message %d = %+v, want result of call %s", i, msg, calls[i].ID)
+		}
+	}
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak concurrency = %d, want 2", got)
+	}
+}
+
+func TestToolMiddlewareOrder(t *testing.T) {
+	var order []string
+	record := func(name string) tools.Middleware {
+		return func(next tools.ToolHandler) tools.ToolHandler {
+			return func(ctx context.Context, args string) (string, error) {
+				order = append(order, name)
+				return next(ctx, args)
+			}
+		}
+	}
+	a := NewAgent(newFakeChatModel(), true)
+	a.Use(record("agent-1"), record("agent-2"))
+	a.UseTool("echo", record("agent-tool"))
+	a.RegisterTool(tools.New("echo", func(ctx context.Context, args string) (string, error) {
+		info, _ := tools.CallInfoFromContext(ctx)
+		order = append(order, "handler:"+info.CallID)
+		return args, nil
+	}, tools.WithMiddleware(record("tool"))))
+
+	runToolCalls(t, a, []llm.ToolCall{{ID: "c1", Name: "echo", Arguments: "{}"}})
+	want := "[agent-1 agent-2 agent-tool tool handler:c1]"
+	if got := fmt.Sprint(order); got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+}
+
+func TestToolMiddlewareVeto(t *testing.T) {
+	called := false
+	a := NewAgent(newFakeChatModel(), true)
+	a.Use(tools.Veto(func(_ context.Context, info tools.CallInfo, _ string) error {
+		return fmt.Errorf("%s is disabled", info.ToolName)
+	}))
+	a.RegisterTool(tools.New("danger", func(context.Context, string) (string, error) {
+		called = true
+		return "", nil
+	}))
+
+	msgs := runToolCalls(t, a, []llm.ToolCall{{ID: "c1", Name: "danger"}})
+	if called {
+		t.Fatal("vetoed handler must not run")
+	}
+	if !strings.Contains(msgs[0].Content, "danger is disabled") {
+		t.Fatalf("veto reason not reported: %q", msgs[0].Content)
+	}
+}
+
+func TestToolApproval(t *testing.T) {
+	var gotArgs []string
+	a := NewAgent(newFakeChatModel(), true)
+	a.RegisterTool(tools.New("send", func(_ context.Context, args string) (string, error) {
+		gotArgs = append(gotArgs, args)
+		return "sent", nil
+	}, tools.WithApproval()))
+	call := llm.ToolCall{ID: "c1", Name: "send", Arguments: `{"to":"b"}`}
+
+	msgs := runToolCalls(t, a, []llm.ToolCall{call})
+	if len(gotArgs) != 0 || !strings.Contains(msgs[0].Content, "no approver") {
+		t.Fatalf("call without approver should be denied, got %q", msgs[0].Content)
+	}
+
+	a.SetApprover(ApproverFunc(func(_ context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		return ApprovalDecision{Action: ApprovalDeny, Reason: "not today"}, nil
+	}))
+	var events []StreamEventType
+	msgs, _, err := a.executeToolCalls(context.Background(), []llm.ToolCall{call}, func(ev StreamEvent) {
+		events = append(events, ev.Type)
+	})
+	if err != nil {
+		t.Fatalf("executeToolCalls: %v", err)
+	}
+	if len(gotArgs) != 0 || msgs[0].Content != "Tool call denied: not today" {
+		t.Fatalf("deny reason not sent back, got %q", msgs[0].Content)
+	}
+	if fmt.Sprint(events) != fmt.Sprint([]StreamEventType{StreamEventToolCall, StreamEventToolResult}) {
+		t.Fatalf("denied call events = %v", events)
+	}
+
+	a.SetApprover(ApproverFunc(func(_ context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		return ApprovalDecision{Action: ApprovalEdit, Arguments: `{"to":"c"}`}, nil
+	}))
+	msgs = runToolCalls(t, a, []llm.ToolCall{call})
+	if fmt.Sprint(gotArgs) != `[{"to":"c"}]` || msgs[0].Content != "sent" {
+		t.Fatalf("edited arguments not used: %v %q", gotArgs, msgs[0].Content)
+	}
+}
+
+func TestApprovalEditIsRecorded(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "c1", Name: "send", Arguments: `{"to":"b"}`}),
+		textResponse("done"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(tools.New("send", func(context.Context, string) (string, error) {
+		return "sent", nil
+	}, tools.WithApproval()))
+	a.SetApprover(ApproverFunc(func(context.Context, ApprovalRequest) (ApprovalDecision, error) {
+		return ApprovalDecision{Action: ApprovalEdit, Arguments: `{"to":"c"}`}, nil
+	}))
+
+	result, err := a.InvokeWithResult(context.Background(), "send it")
+	if err != nil {
+		t.Fatalf("InvokeWithResult: %v", err)
+	}
+	msgs := model.Requests()[1].Messages
+	if call := msgs[len(msgs)-2].ToolCalls; len(call) != 1 || call[0].Arguments != `{"to":"c"}` {
+		t.Fatalf("transcript keeps the original arguments: %+v", msgs[len(msgs)-2])
+	}
+	if result.Trace[0].Arguments != `{"to":"c"}` {
+		t.Fatalf("trace keeps the original arguments: %+v", result.Trace[0])
+	}
+}
+
+func TestInvalidArgumentsSkipHandler(t *testing.T) {
+	called := false
+	a := NewAgent(newFakeChatModel(), true)
+	a.RegisterTool(tools.New("get_weather", func(context.Context, string) (string, error) {
+		called = true
+		return "sunny", nil
+	}, tools.WithParameters(tools.ObjectSchema(map[string]any{
+		"location": tools.StringProperty("City."),
+	}, "location"))))
+
+	msgs := runToolCalls(t, a, []llm.ToolCall{{ID: "c1", Name: "get_weather", Arguments: `{"city":"Paris"}`}})
+	if called {
+		t.Fatal("handler must not run on invalid arguments")
+	}
+	if !strings.Contains(msgs[0].Content, `"error":"invalid_arguments"`) || !strings.Contains(msgs[0].Content, `"path":"location"`) {
+		t.Fatalf("structured error missing: %s", msgs[0].Content)
+	}
+}
+
+func runToolCalls(t *testing.T, a *Agent, calls []llm.ToolCall) []Message {
+	t.Helper()
+	msgs, _, err := a.executeToolCalls(context.Background(), calls, nil)
+	if err != nil {
+		t.Fatalf("executeToolCalls: %v", err)
+	}
+	return msgs
+}
+
+func TestToolTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cancelled := make(chan struct{})
+	a := NewAgent(newFakeChatModel(), true)
+	a.ToolTimeout = time.Hour
+	a.RegisterTool(tools.New("stuck", func(ctx context.Context, _ string) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		<-release // ignores cancellation for a while, like a misbehaving handler
+		return "late", nil
+	}, tools.WithTimeout(20*time.Millisecond)))
+
+	start := time.Now()
+	msgs := runToolCalls(t, a, []llm.ToolCall{{ID: "c1", Name: "stuck"}})
+	if time.Since(start) > time.Second {
+		t.Fatal("per-tool timeout was not applied")
+	}
+	if !strings.Contains(msgs[0].Content, "Tool stuck timed out") {
+		t.Fatalf("unexpected result: %q", msgs[0].Content)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+}
+
+func TestToolAttachmentsReachModel(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "screenshot", Arguments: `{}`}),
+		textResponse("I see it"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterToolFunc("screenshot", func(ctx context.Context, _ string) (string, error) {
+		tools.Attach(ctx, llm.ImageURLPart("data:image/png;base64,AAAA"))
+		return "captured", nil
+	})
+
+	photo := llm.ImageURLPart("https://example.com/cat.png")
+	if _, err := a.InvokeWithAttachments(context.Background(), "look", photo); err != nil {
+		t.Fatalf("InvokeWithAttachments: %v", err)
+	}
+	reqs := model.Requests()
+	first := reqs[0].Messages[len(reqs[0].Messages)-1]
+	if len(first.Parts) != 1 || first.Parts[0] != photo {
+		t.Fatalf("user attachment not sent: %+v", first)
+	}
+	msgs := reqs[1].Messages
+	toolMsg, attachMsg := msgs[len(msgs)-2], msgs[len(msgs)-1]
+	if toolMsg.Role != llm.RoleTool || toolMsg.Content != "captured" || len(toolMsg.Parts) != 0 {
+		t.Fatalf("unexpected tool message: %+v", toolMsg)
+	}
+	if attachMsg.Role != llm.RoleUser || len(attachMsg.Parts) != 2 || attachMsg.Parts[1].ImageURL != "data:image/png;base64,AAAA" {
+		t.Fatalf("tool image not forwarded: %+v", attachMsg)
+	}
+}
@@ -1,6 +1,14 @@
 package tools
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrToolTimeout is reported when a tool call exceeds its timeout or the
+// invocation is cancelled while the tool is running.
+var ErrToolTimeout = errors.New("tool timed out")
 
 // ToolHandler defines the tool handler signature.
 type ToolHandler func(ctx context.Context, args string) (string, error)
@@ -18,6 +26,12 @@ type Tool struct {
 	Parameters  map[string]any
 	Handler     ToolHandler
 	Kind        ToolKind
+	Serial      bool // must not run concurrently with other tool calls
+	// RequiresApproval asks the agent's Approver before every call.
+	RequiresApproval bool
+	// Timeout overrides the agent's default tool timeout when positive.
+	Timeout     time.Duration
+	Middlewares []Middleware
 }
 
 type Option func(*Tool)
@@ -34,6 +48,15 @@ func New(name string, handler ToolHandler, opts ...Option) Tool {
 	return t
 }
 
+// With returns a copy of the tool with extra options applied, e.g. to mark
+// a builtin tool as requiring approval.
+func (t Tool) With(opts ...Option) Tool {
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
+}
+
 func WithDescription(description string) Option {
 	return func(t *Tool) {
 		t.Description = description
@@ -52,6 +75,29 @@ func WithKind(kind ToolKind) Option {
 	}
 }
 
+// WithSerial marks a tool that must run alone, never in parallel with
+// other tool calls of the same turn.
+func WithSerial() Option {
+	return func(t *Tool) {
+		t.Serial = true
+	}
+}
+
+// WithApproval marks a side-effecting tool that a person must confirm
+// before it runs.
+func WithApproval() Option {
+	return func(t *Tool) {
+		t.RequiresApproval = true
+	}
+}
+
+// WithTimeout limits how long a single call of the tool may run.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Tool) {
+		t.Timeout = timeout
+	}
+}
+
 func ObjectSchema(properties map[string]any, required ...string) map[string]any {
 	schema := map[string]any{
 		"type":       "object",
@@ -82,3 +128,42 @@ func IntProperty(description string) map[string]any {
 	}
 	return prop
 }
+
+func NumberProperty(description string) map[string]any {
+	prop := map[string]any{
+		"type": "number",
+	}
+	if description != "" {
+		prop["description"] = description
+	}
+	return prop
+}
+
+func BoolProperty(description string) map[string]any {
+	prop := map[string]any{
+		"type": "boolean",
+	}
+	if description != "" {
+		prop["description"] = description
+	}
+	return prop
+}
+
+// EnumProperty is a string property restricted to values.
+func EnumProperty(description string, values ...string) map[string]any {
+	prop := StringProperty(description)
+	prop["enum"] = values
+	return prop
+}
+
+// ArrayProperty is an array whose elements match items.
+func ArrayProperty(description string, items map[string]any) map[string]any {
+	prop := map[string]any{
+		"type":  "array",
+		"items": items,
+	}
+	if description != "" {
+		prop["description"] = description
+	}
+	return prop
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"context"
+	"sync"
+
+	"agent/llm"
+)
+
+type attachmentsKey struct{}
+
+type attachments struct {
+	mu    sync.Mutex
+	parts []llm.ContentPart
+}
+
+// Attach sends content parts, such as a screenshot, back to the model along
+// with the tool's text result. Outside an agent tool call it does nothing.
+func Attach(ctx context.Context, parts ...llm.ContentPart) {
+	if a, ok := ctx.Value(attachmentsKey{}).(*attachments); ok {
+		a.mu.Lock()
+		a.parts = append(a.parts, parts...)
+		a.mu.Unlock()
+	}
+}
+
+// WithAttachments returns a context that collects Attach calls, and a
+// function that returns the parts attached so far.
+func WithAttachments(ctx context.Context) (context.Context, func() []llm.ContentPart) {
+	a := &attachments{}
+	return context.WithValue(ctx, attachmentsKey{}, a), func() []llm.ContentPart {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return append([]llm.ContentPart(nil), a.parts...)
+	}
+}
@@ -3,7 +3,6 @@ package buildin
 import (
 	"agent/tools"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,20 +11,17 @@ import (
 	"time"
 )
 
+type getWeatherInput struct {
+	Location string `json:"location" required:"true" min:"1" description:"City or location name."`
+}
+
 func NewGetWeatherTool() tools.Tool {
-	return tools.New(
+	return tools.NewTyped(
 		"get_weather",
-		func(ctx context.Context, args string) (string, error) {
-			var input struct {
-				Location string `json:"location"`
-			}
-			if err := json.Unmarshal([]byte(args), &input); err != nil {
-				return "", fmt.Errorf("parse args: %w", err)
-			}
+		func(ctx context.Context, input getWeatherInput) (string, error) {
 			if strings.TrimSpace(input.Location) == "" {
 				return "", fmt.Errorf("location is required")
 			}
-
 			weatherURL := "https://wttr.in/" + url.PathEscape(input.Location) + "?format=3"
 			client := &http.Client{Timeout: 10 * time.Second}
 			req, err := http.NewRequestWithContext(ctx, http.MethodGet, weatherURL, nil)
@@ -47,8 +43,5 @@ func NewGetWeatherTool() tools.Tool {
 			return string(body), nil
 		},
 		tools.WithDescription("Get current weather for a location."),
-		tools.WithParameters(tools.ObjectSchema(map[string]any{
-			"location": tools.StringProperty("City or location name."),
-		}, "location")),
 	)
 }
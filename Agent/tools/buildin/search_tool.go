@@ -11,24 +11,21 @@ import (
 	"time"
 )
 
+type webSearchInput struct {
+	Query      string `json:"query" required:"true" min:"1" description:"The search query."`
+	MaxResults int    `json:"max_results" default:"5" description:"Maximum number of results to return; 0 or less uses the default."`
+}
+
 func NewWebSearchTool() tools.Tool {
-	return tools.New(
+	return tools.NewTyped(
 		"web_search",
-		func(ctx context.Context, args string) (string, error) {
-			var input struct {
-				Query      string `json:"query"`
-				MaxResults int    `json:"max_results"`
-			}
-			if err := json.Unmarshal([]byte(args), &input); err != nil {
-				return "", fmt.Errorf("parse args: %w", err)
-			}
+		func(ctx context.Context, input webSearchInput) (string, error) {
 			if strings.TrimSpace(input.Query) == "" {
 				return "", fmt.Errorf("query is required")
 			}
 			if input.MaxResults <= 0 {
 				input.MaxResults = 5
 			}
-
 			searchURL := "https://api.duckduckgo.com/?q=" + url.QueryEscape(input.Query) + "&format=json&no_redirect=1&no_html=1"
 			client := &http.Client{Timeout: 10 * time.Second}
 			req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
@@ -80,9 +77,5 @@ func NewWebSearchTool() tools.Tool {
 			return strings.Join(lines, "\n"), nil
 		},
 		tools.WithDescription("Search the web for information."),
-		tools.WithParameters(tools.ObjectSchema(map[string]any{
-			"query":       tools.StringProperty("The search query."),
-			"max_results": tools.IntProperty("Maximum number of results to return."),
-		}, "query")),
 	)
 }
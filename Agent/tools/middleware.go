@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a ToolHandler with cross-cutting behavior.
+type Middleware func(next ToolHandler) ToolHandler
+
+// ErrVetoed is returned when a middleware refuses to run a tool call.
+var ErrVetoed = errors.New("tool call vetoed")
+
+// CallInfo describes the tool call a handler is running for.
+type CallInfo struct {
+	ToolName string
+	CallID   string
+}
+
+type callInfoKey struct{}
+
+// WithCallInfo attaches call information to ctx for middlewares and handlers.
+func WithCallInfo(ctx context.Context, info CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext returns the call information set by WithCallInfo.
+func CallInfoFromContext(ctx context.Context) (CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(CallInfo)
+	return info, ok
+}
+
+// Chain wraps handler with middlewares. The first middleware is the
+// outermost one: it sees the call first and the result last.
+func Chain(handler ToolHandler, middlewares ...Middleware) ToolHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// WithMiddleware registers middlewares that only apply to this tool.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(t *Tool) {
+		t.Middlewares = append(t.Middlewares, middlewares...)
+	}
+}
+
+// Logging logs each call and its outcome. Values of the given argument keys
+// are replaced by "***" at any depth.
+func Logging(redactKeys ...string) Middleware {
+	redact := make(map[string]struct{}, len(redactKeys))
+	for _, key := range redactKeys {
+		redact[key] = struct{}{}
+	}
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			info, _ := CallInfoFromContext(ctx)
+			log.Printf("tool %s call %s args: %s", info.ToolName, info.CallID, redactArgs(args, redact))
+			result, err := next(ctx, args)
+			if err != nil {
+				log.Printf("tool %s call %s failed: %v", info.ToolName, info.CallID, err)
+			}
+			return result, err
+		}
+	}
+}
+
+// Timing reports how long each call took.
+func Timing(report func(info CallInfo, elapsed time.Duration, err error)) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			info, _ := CallInfoFromContext(ctx)
+			report(info, time.Since(start), err)
+			return result, err
+		}
+	}
+}
+
+// Cache memoizes successful results by tool name and arguments for ttl.
+func Cache(ttl time.Duration) Middleware {
+	type entry struct {
+		result  string
+		expires time.Time
+	}
+	var mu sync.Mutex
+	entries := make(map[string]entry)
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			info, _ := CallInfoFromContext(ctx)
+			key := info.ToolName + "\x00" + args
+			mu.Lock()
+			e, ok := entries[key]
+			mu.Unlock()
+			if ok && time.Now().Before(e.expires) {
+				return e.result, nil
+			}
+			result, err := next(ctx, args)
+			if err == nil {
+				mu.Lock()
+				entries[key] = entry{result: result, expires: time.Now().Add(ttl)}
+				mu.Unlock()
+			}
+			return result, err
+		}
+	}
+}
+
+// Retry re-runs a failing call up to attempts times in total, doubling the
+// backoff between attempts. Vetoed calls are not retried.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			var result string
+			var err error
+			for i := 0; i < max(attempts, 1); i++ {
+				if i > 0 {
+					select {
+					case <-time.After(backoff << uint(i-1)):
+					case <-ctx.Done():
+						return "", ctx.Err()
+					}
+				}
+				result, err = next(ctx, args)
+				if err == nil || errors.Is(err, ErrVetoed) {
+					return result, err
+				}
+			}
+			return result, err
+		}
+	}
+}
+
+// RewriteArgs replaces the arguments before the call is dispatched.
+func RewriteArgs(rewrite func(ctx context.Context, args string) (string, error)) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			rewritten, err := rewrite(ctx, args)
+			if err != nil {
+				return "", fmt.Errorf("rewrite args: %w", err)
+			}
+			return next(ctx, rewritten)
+		}
+	}
+}
+
+// Veto blocks a call when check returns an error; the handler never runs.
+func Veto(check func(ctx context.Context, info CallInfo, args string) error) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			info, _ := CallInfoFromContext(ctx)
+			if err := check(ctx, info, args); err != nil {
+				return "", fmt.Errorf("%w: %v", ErrVetoed, err)
+			}
+			return next(ctx, args)
+		}
+	}
+}
+
+// MapResult post-processes the result (and error) of every call.
+func MapResult(mapper func(ctx context.Context, result string, err error) (string, error)) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, args string) (string, error) {
+			result, err := next(ctx, args)
+			return mapper(ctx, result, err)
+		}
+	}
+}
+
+func redactArgs(args string, keys map[string]struct{}) string {
+	if len(keys) == 0 {
+		return args
+	}
+	var value any
+	if err := json.Unmarshal([]byte(args), &value); err != nil {
+		return args
+	}
+	data, err := json.Marshal(redactValue(value, keys))
+	if err != nil {
+		return args
+	}
+	return string(data)
+}
+
+func redactValue(value any, keys map[string]struct{}) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if _, ok := keys[key]; ok {
+				v[key] = "***"
+				continue
+			}
+			v[key] = redactValue(item, keys)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item, keys)
+		}
+	}
+	return value
+}
@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationIssue is a single schema violation. Path uses dots for object
+// keys and [i] for array items; the empty path is the arguments object.
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every violation found in a set of arguments.
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		if issue.Path == "" {
+			parts = append(parts, issue.Message)
+			continue
+		}
+		parts = append(parts, issue.Path+": "+issue.Message)
+	}
+	return "invalid arguments: " + strings.Join(parts, "; ")
+}
+
+// ValidateArguments checks raw JSON arguments against a JSON Schema
+// (the subset produced by this package: type, properties, required, enum,
+// minimum/maximum, length and item limits, pattern, additionalProperties).
+// It returns a *ValidationError on schema violations.
+func ValidateArguments(schema map[string]any, args string) error {
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(args)))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return &ValidationError{Issues: []ValidationIssue{{Message: fmt.Sprintf("arguments are not valid JSON: %v", err)}}}
+	}
+	if issues := Validate(schema, value); len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON value against schema.
+func Validate(schema map[string]any, value any) []ValidationIssue {
+	var issues []ValidationIssue
+	validateValue(schema, value, "", &issues)
+	return issues
+}
+
+func validateValue(schema map[string]any, value any, path string, issues *[]ValidationIssue) {
+	if schema == nil {
+		return
+	}
+	report := func(format string, args ...any) {
+		*issues = append(*issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		if !typeMatches(types, actual, value) {
+			report("expected %s, got %s", strings.Join(types, " or "), actual)
+			return
+		}
+		if value == nil {
+			// An allowed null has nothing else to check.
+			return
+		}
+	}
+	if enum, ok := schema["enum"]; ok {
+		values := toSlice(enum)
+		if !containsValue(values, value) {
+			report("must be one of %s", formatValues(values))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n, ok := schemaNumber(schema["minLength"]); ok && float64(length) < n {
+			report("must be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > n {
+			report("must be at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				report("must match pattern %q", pattern)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(schema["minimum"]); ok && f < n {
+			report("must be >= %v", n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && f > n {
+			report("must be <= %v", n)
+		}
+		if n, ok := schemaNumber(schema["exclusiveMinimum"]); ok && f <= n {
+			report("must be > %v", n)
+		}
+		if n, ok := schemaNumber(schema["exclusiveMaximum"]); ok && f >= n {
+			report("must be < %v", n)
+		}
+	case []any:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < n {
+			report("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > n {
+			report("must have at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), issues)
+			}
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range toStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*issues = append(*issues, ValidationIssue{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			propSchema, ok := properties[key].(map[string]any)
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case bool:
+					if !additional {
+						*issues = append(*issues, ValidationIssue{Path: joinPath(path, key), Message: "is not an allowed property"})
+					}
+				case map[string]any:
+					validateValue(additional, v[key], joinPath(path, key), issues)
+				}
+				continue
+			}
+			validateValue(propSchema, v[key], joinPath(path, key), issues)
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func schemaTypes(raw any) []string {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}
+	default:
+		return toStrings(raw)
+	}
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func typeMatches(types []string, actual string, value any) bool {
+	for _, t := range types {
+		switch {
+		case t == actual:
+			return true
+		case t == "number" && actual == "integer":
+			return true
+		case t == "integer" && actual == "number":
+			// 1.0 is still an integer in JSON Schema.
+			f, _ := value.(json.Number).Float64()
+			if f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaNumber(raw any) (float64, bool) {
+	switch n := raw.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toSlice(raw any) []any {
+	switch v := raw.(type) {
+	case []any:
+		return v
+	case []string:
+		out := make([]any, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	case []int:
+		out := make([]any, len(v))
+		for i, n := range v {
+			out[i] = n
+		}
+		return out
+	}
+	return nil
+}
+
+func toStrings(raw any) []string {
+	switch v := raw.(type) {
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func containsValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if equalJSON(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares a schema literal with a decoded value, treating
+// numbers by value.
+func equalJSON(a, b any) bool {
+	if na, ok := schemaNumber(a); ok {
+		nb, ok := schemaNumber(b)
+		return ok && na == nb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func formatValues(values []any) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(data)
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	schema := ObjectSchema(map[string]any{
+		"query": StringProperty("The search query."),
+		"unit":  EnumProperty("Unit.", "c", "f"),
+		"limit": map[string]any{"type": "integer", "minimum": 1, "maximum": 10},
+		"tags":  ArrayProperty("Tags.", StringProperty("")),
+		"filter": ObjectSchema(map[string]any{
+			"site": StringProperty("Site."),
+		}, "site"),
+		"weights": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "number"}},
+	}, "query")
+
+	cases := []struct {
+		name  string
+		args  string
+		paths []string
+	}{
+		{name: "valid", args: `{"query":"go","unit":"c","limit":3,"tags":["a"],"filter":{"site":"x"}}`},
+		{name: "integer written as float", args: `{"query":"go","limit":3.0}`},
+		{name: "missing required", args: `{"limit":3}`, paths: []string{"query"}},
+		{name: "wrong type", args: `{"query":5}`, paths: []string{"query"}},
+		{name: "enum", args: `{"query":"go","unit":"k"}`, paths: []string{"unit"}},
+		{name: "range", args: `{"query":"go","limit":11}`, paths: []string{"limit"}},
+		{name: "fraction for integer", args: `{"query":"go","limit":1.5}`, paths: []string{"limit"}},
+		{name: "array items", args: `{"query":"go","tags":["a",2]}`, paths: []string{"tags[1]"}},
+		{name: "nested object", args: `{"query":"go","filter":{}}`, paths: []string{"filter.site"}},
+		{name: "map values", args: `{"query":"go","weights":{"a":1,"b":"x"}}`, paths: []string{"weights.b"}},
+		{name: "malformed json", args: `{"query":`, paths: []string{""}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateArguments(schema, tc.args)
+			if len(tc.paths) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("want *ValidationError, got %v", err)
+			}
+			if len(verr.Issues) != len(tc.paths) {
+				t.Fatalf("issues = %+v, want paths %v", verr.Issues, tc.paths)
+			}
+			for i, path := range tc.paths {
+				if verr.Issues[i].Path != path {
+					t.Fatalf("issue %d path = %q, want %q", i, verr.Issues[i].Path, path)
+				}
+			}
+		})
+	}
+}
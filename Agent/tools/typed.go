@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewTyped builds a tool from a typed function. The parameter schema is
+// derived from In (see SchemaFor); arguments are validated, completed with
+// defaults and decoded into In before fn runs. A string result is returned
+// as-is, any other Out is marshaled to JSON.
+func NewTyped[In, Out any](name string, fn func(ctx context.Context, in In) (Out, error), opts ...Option) Tool {
+	schema := SchemaFor[In]()
+	handler := func(ctx context.Context, args string) (string, error) {
+		var in In
+		if err := DecodeArguments(schema, args, &in); err != nil {
+			return "", err
+		}
+		out, err := fn(ctx, in)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := any(out).(string); ok {
+			return s, nil
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return "", fmt.Errorf("marshal result: %w", err)
+		}
+		return string(data), nil
+	}
+	return New(name, handler, append([]Option{WithParameters(schema)}, opts...)...)
+}
+
+// DecodeArguments validates args against schema, fills in schema defaults
+// for missing properties and decodes the result into out.
+func DecodeArguments(schema map[string]any, args string, out any) error {
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	if err := ValidateArguments(schema, args); err != nil {
+		return err
+	}
+	// Numbers stay json.Number so large integers survive the re-encoding.
+	var value any
+	decoder := json.NewDecoder(strings.NewReader(args))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+	applyDefaults(schema, value)
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+	return nil
+}
+
+// SchemaFor derives a JSON Schema from T. Struct fields use their json
+// names, pointer fields also accept null, and these tags apply:
+//
+//	description:"..."  property description
+//	required:"true"    property must be present
+//	enum:"a,b,c"       allowed values
+//	default:"5"        value used when the property is missing
+//	min:"1" max:"10"   bounds (value for numbers, length for strings,
+//	                   item count for arrays)
+func SchemaFor[T any]() map[string]any {
+	return SchemaOf(reflect.TypeFor[T]())
+}
+
+// SchemaOf derives a JSON Schema from t, as described for SchemaFor.
+func SchemaOf(t reflect.Type) map[string]any {
+	return schemaOfType(t, map[reflect.Type]bool{})
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func schemaOfType(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0.0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{"type": "array", "items": schemaOfType(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOfType(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// Recursive types are left open rather than expanded forever.
+			return map[string]any{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		properties := map[string]any{}
+		required := []string{}
+		collectFields(t, properties, &required, seen)
+		return ObjectSchema(properties, required...)
+	default:
+		return map[string]any{}
+	}
+}
+
+func collectFields(t reflect.Type, properties map[string]any, required *[]string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, properties, required, seen)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop := schemaOfType(field.Type, seen)
+		applyFieldTags(prop, field)
+		if field.Type.Kind() == reflect.Pointer {
+			allowNull(prop)
+		}
+		properties[name] = prop
+		if field.Tag.Get("required") == "true" {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func applyFieldTags(prop map[string]any, field reflect.StructField) {
+	if desc := field.Tag.Get("description"); desc != "" {
+		prop["description"] = desc
+	}
+	if enum := field.Tag.Get("enum"); enum != "" {
+		values := make([]any, 0)
+		for _, item := range strings.Split(enum, ",") {
+			values = append(values, parseTagValue(prop, strings.TrimSpace(item)))
+		}
+		prop["enum"] = values
+	}
+	if def, ok := field.Tag.Lookup("default"); ok {
+		prop["default"] = parseTagValue(prop, def)
+	}
+	minKey, maxKey := "minimum", "maximum"
+	switch prop["type"] {
+	case "string":
+		minKey, maxKey = "minLength", "maxLength"
+	case "array":
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	if v, err := strconv.ParseFloat(field.Tag.Get("min"), 64); err == nil {
+		prop[minKey] = v
+	}
+	if v, err := strconv.ParseFloat(field.Tag.Get("max"), 64); err == nil {
+		prop[maxKey] = v
+	}
+}
+
+// allowNull adds null to the property's type, for a pointer left nil.
+func allowNull(prop map[string]any) {
+	if t, ok := prop["type"].(string); ok {
+		prop["type"] = []any{t, "null"}
+	}
+}
+
+// parseTagValue converts a tag literal to the property's JSON type.
+func parseTagValue(prop map[string]any, raw string) any {
+	if prop["type"] == "string" {
+		return raw
+	}
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+	return value
+}
+
+// applyDefaults fills missing object properties with their schema defaults,
+// descending into nested objects and arrays.
+func applyDefaults(schema map[string]any, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for name, raw := range properties {
+			prop, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			if _, present := v[name]; !present {
+				if def, ok := prop["default"]; ok {
+					v[name] = def
+				}
+				continue
+			}
+			applyDefaults(prop, v[name])
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for _, item := range v {
+				applyDefaults(items, item)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type searchInput struct {
+	Query   string   `json:"query" required:"true" min:"1" description:"The search query."`
+	Limit   int      `json:"limit,omitempty" default:"5" min:"1" max:"10"`
+	Unit    string   `json:"unit,omitempty" enum:"c,f" default:"c"`
+	Tags    []string `json:"tags,omitempty" max:"3"`
+	Ignored string   `json:"-"`
+}
+
+type searchOutput struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+	Unit  string `json:"unit"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor[searchInput]()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("marshal schema: %v", err)
+	}
+	want := `{"properties":{"limit":{"default":5,"maximum":10,"minimum":1,"type":"integer"},` +
+		`"query":{"description":"The search query.","minLength":1,"type":"string"},` +
+		`"tags":{"items":{"type":"string"},"maxItems":3,"type":"array"},` +
+		`"unit":{"default":"c","enum":["c","f"],"type":"string"}},"required":["query"],"type":"object"}`
+	if string(data) != want {
+		t.Fatalf("schema =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestNewTyped(t *testing.T) {
+	tool := NewTyped("search", func(_ context.Context, in searchInput) (searchOutput, error) {
+		return searchOutput{Query: in.Query, Limit: in.Limit, Unit: in.Unit}, nil
+	})
+
+	result, err := tool.Handler(context.Background(), `{"query":"go"}`)
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if result != `{"query":"go","limit":5,"unit":"c"}` {
+		t.Fatalf("result = %s", result)
+	}
+
+	_, err = tool.Handler(context.Background(), `{"query":"go","unit":"k"}`)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("want validation error, got %v", err)
+	}
+}
+
+type filterInput struct {
+	Site    *string            `json:"site" enum:"a,b" description:"Restrict to a site."`
+	MaxAge  *int               `json:"max_age" min:"1"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+func TestTypedPointerAndMapFields(t *testing.T) {
+	schema := SchemaFor[filterInput]()
+	var in filterInput
+	if err := DecodeArguments(schema, `{"site":null,"max_age":null,"weights":{"x":0.5}}`, &in); err != nil {
+		t.Fatalf("null for pointer fields rejected: %v", err)
+	}
+	if in.Site != nil || in.MaxAge != nil || in.Weights["x"] != 0.5 {
+		t.Fatalf("decoded %+v", in)
+	}
+	if err := DecodeArguments(schema, `{"site":"a","max_age":3}`, &in); err != nil || *in.Site != "a" || *in.MaxAge != 3 {
+		t.Fatalf("decoded %+v, err %v", in, err)
+	}
+
+	err := ValidateArguments(schema, `{"site":"c","max_age":0,"weights":{"x":"heavy"}}`)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Issues) != 3 {
+		t.Fatalf("want issues for site, max_age and weights.x, got %v", err)
+	}
+}
+
+type countInput struct {
+	ID    int64 `json:"id"`
+	Count uint  `json:"count"`
+}
+
+func TestDecodeArgumentsKeepsIntegers(t *testing.T) {
+	schema := SchemaFor[countInput]()
+	var in countInput
+	if err := DecodeArguments(schema, `{"id":9007199254740993,"count":2}`, &in); err != nil {
+		t.Fatalf("DecodeArguments: %v", err)
+	}
+	if in.ID != 9007199254740993 || in.Count != 2 {
+		t.Fatalf("decoded %+v", in)
+	}
+
+	err := DecodeArguments(schema, `{"count":-1}`, &in)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("want validation error for a negative uint, got %v", err)
+	}
+}
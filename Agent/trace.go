@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agent/llm"
+)
+
+// TraceStep records a tool call, answer or critique of an invocation. Only
+// the first step of a round carries its Usage and ModelLatency.
+type TraceStep struct {
+	Round        int           `json:"round"`
+	Thought      string        `json:"thought,omitempty"`
+	Tool         string        `json:"tool,omitempty"`
+	CallID       string        `json:"call_id,omitempty"`
+	Arguments    string        `json:"arguments,omitempty"`
+	Observation  string        `json:"observation,omitempty"`
+	Latency      time.Duration `json:"latency"`       // tool execution time
+	ModelLatency time.Duration `json:"model_latency"` // time to get the completion
+	Usage        llm.Usage     `json:"usage"`
+	Final        bool          `json:"final,omitempty"`    // an answer, possibly a draft revised later
+	Critique     string        `json:"critique,omitempty"` // the critic's review of the preceding answer
+	Approved     bool          `json:"approved,omitempty"`
+}
+
+// MarshalJSON writes durations as strings such as "1.2s".
+func (s TraceStep) MarshalJSON() ([]byte, error) {
+	type plain TraceStep
+	return json.Marshal(struct {
+		plain
+		Latency      string `json:"latency"`
+		ModelLatency string `json:"model_latency"`
+	}{plain(s), s.Latency.String(), s.ModelLatency.String()})
+}
+
+// InvokeWithTrace answers userQuery and returns the steps that led to the
+// answer. The same trace is available as InvokeResult.Trace.
+func (a *Agent) InvokeWithTrace(ctx context.Context, userQuery string) (string, []TraceStep, error) {
+	result, err := a.InvokeWithResult(ctx, userQuery)
+	if err != nil {
+		return "", nil, err
+	}
+	return result.Content, result.Trace, nil
+}
+
+// roundTrace starts the trace of one model round.
+func roundTrace(round int, thought string, resp *llm.Response, latency time.Duration) TraceStep {
+	return TraceStep{Round: round, Thought: thought, Usage: resp.Usage, ModelLatency: latency}
+}
+
+// finalStep marks the round that produced the answer. With the native
+// protocol the content is the answer itself rather than a thought.
+func finalStep(step TraceStep, react bool) TraceStep {
+	if !react {
+		step.Thought = ""
+	}
+	step.Final = true
+	return step
+}
+
+// toolSteps expands a round into one step per tool call.
+func toolSteps(round TraceStep, calls []llm.ToolCall, results []Message, latencies []time.Duration) []TraceStep {
+	steps := make([]TraceStep, 0, len(calls))
+	for i, call := range calls {
+		step := round
+		if i > 0 {
+			step.Usage = llm.Usage{}
+			step.ModelLatency = 0
+		}
+		step.Tool = call.Name
+		step.CallID = call.ID
+		step.Arguments = call.Arguments
+		step.Observation = results[i].Content
+		step.Latency = latencies[i]
+		steps = append(steps, step)
+	}
+	return steps
+}
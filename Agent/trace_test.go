@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"agent/llm"
+)
+
+func TestInvokeWithTrace(t *testing.T) {
+	first := toolCallResponse(
+		llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{"x":1}`},
+		llm.ToolCall{ID: "call_2", Name: "echo", Arguments: `{"x":2}`},
+	)
+	first.Message.Content = "I will call echo twice."
+	first.Usage = llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	second := textResponse("done")
+	second.Usage = llm.Usage{PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22}
+	a := NewAgent(newFakeChatModel(first, second), true)
+	a.RegisterTool(echoTool("echo"))
+
+	reply, trace, err := a.InvokeWithTrace(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("InvokeWithTrace: %v", err)
+	}
+	if reply != "done" {
+		t.Fatalf("reply = %q", reply)
+	}
+	if len(trace) != 3 {
+		t.Fatalf("got %d steps, want 3: %+v", len(trace), trace)
+	}
+	if s := trace[0]; s.Round != 1 || s.Thought != "I will call echo twice." || s.Tool != "echo" || s.Arguments != `{"x":1}` || s.Observation != `echo:{"x":1}` || s.Usage != first.Usage {
+		t.Fatalf("unexpected first step: %+v", s)
+	}
+	if s := trace[1]; s.CallID != "call_2" || s.Observation != `echo:{"x":2}` || s.Usage != (llm.Usage{}) {
+		t.Fatalf("unexpected second step: %+v", s)
+	}
+	if s := trace[2]; s.Round != 2 || !s.Final || s.Tool != "" || s.Usage != second.Usage {
+		t.Fatalf("unexpected final step: %+v", s)
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("marshal trace: %v", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal trace: %v", err)
+	}
+	if latency, ok := decoded[0]["latency"].(string); !ok || !strings.HasSuffix(latency, "s") {
+		t.Fatalf("latency not written as a duration string: %s", data)
+	}
+	if decoded[0]["tool"] != "echo" || decoded[2]["final"] != true {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+}
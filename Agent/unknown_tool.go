@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+// UnknownToolPolicy decides how a call to an unregistered tool is handled.
+type UnknownToolPolicy string
+
+const (
+	// UnknownToolReport answers the call with an error tool message that
+	// lists the available tools.
+	UnknownToolReport UnknownToolPolicy = "report"
+	// UnknownToolFuzzyMatch runs the closest registered tool when the name
+	// is a near miss, and reports like UnknownToolReport otherwise.
+	UnknownToolFuzzyMatch UnknownToolPolicy = "fuzzy_match"
+	// UnknownToolFail aborts the invocation with an *UnknownToolError.
+	UnknownToolFail UnknownToolPolicy = "fail"
+)
+
+// ParseUnknownToolPolicy returns the policy called name. An empty name is
+// UnknownToolReport.
+func ParseUnknownToolPolicy(name string) (UnknownToolPolicy, error) {
+	switch policy := UnknownToolPolicy(name); policy {
+	case "":
+		return UnknownToolReport, nil
+	case UnknownToolReport, UnknownToolFuzzyMatch, UnknownToolFail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown tool policy %q: want %s, %s or %s", name, UnknownToolReport, UnknownToolFuzzyMatch, UnknownToolFail)
+}
+
+// ErrUnknownTool matches any *UnknownToolError with errors.Is.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// UnknownToolError reports a call to a tool that is not registered.
+type UnknownToolError struct {
+	Name      string
+	Available []string
+}
+
+func (e *UnknownToolError) Error() string {
+	return fmt.Sprintf("unknown tool %q (available: %s)", e.Name, strings.Join(e.Available, ", "))
+}
+
+func (e *UnknownToolError) Is(target error) bool {
+	return target == ErrUnknownTool
+}
+
+// toolInvocation is a tool call resolved against the registered tools.
+type toolInvocation struct {
+	call  llm.ToolCall
+	tool  tools.Tool
+	found bool
+	note  string // prefixed to the result, e.g. when the name was corrected
+}
+
+func (a *Agent) resolveToolCall(call llm.ToolCall) (toolInvocation, error) {
+	if tool, ok := a.tools[call.Name]; ok {
+		return toolInvocation{call: call, tool: tool, found: true}, nil
+	}
+	switch a.UnknownToolPolicy {
+	case UnknownToolFail:
+		return toolInvocation{}, &UnknownToolError{Name: call.Name, Available: a.toolNames()}
+	case UnknownToolFuzzyMatch:
+		if name, ok := closestToolName(call.Name, a.toolNames()); ok {
+			return toolInvocation{
+				call:  call,
+				tool:  a.tools[name],
+				found: true,
+				note:  fmt.Sprintf("Note: tool %q does not exist, %q was called instead.\n", call.Name, name),
+			}, nil
+		}
+	}
+	return toolInvocation{call: call}, nil
+}
+
+func (a *Agent) unknownToolResult(name string) string {
+	data, err := json.Marshal(map[string]any{
+		"error":           "unknown_tool",
+		"tool":            name,
+		"available_tools": a.toolNames(),
+		"hint":            "Call one of the available tools instead.",
+	})
+	if err != nil {
+		return fmt.Sprintf("Tool %s not found", name)
+	}
+	return string(data)
+}
+
+func (a *Agent) toolNames() []string {
+	names := make([]string, 0, len(a.tools))
+	for name := range a.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// closestToolName finds the registered name nearest to name. Names are
+// compared case-insensitively without '_' and '-'; a match must be within
+// a third of the name's length in edit distance.
+func closestToolName(name string, candidates []string) (string, bool) {
+	target := normalizeToolName(name)
+	best, bestDist := "", -1
+	for _, candidate := range candidates {
+		dist := editDistance(target, normalizeToolName(candidate))
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+	if bestDist < 0 || bestDist > max(1, len([]rune(target))/3) {
+		return "", false
+	}
+	return best, true
+}
+
+func normalizeToolName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(name)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent/llm"
+	"agent/tools"
+)
+
+func TestUnknownToolReport(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(llm.ToolCall{ID: "call_1", Name: "weather", Arguments: `{}`}),
+		textResponse("sorry"),
+	)
+	a := NewAgent(model, true)
+	a.RegisterTool(echoTool("get_weather"))
+	a.RegisterTool(echoTool("web_search"))
+
+	if _, err := a.Invoke(context.Background(), "weather?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	req := model.Requests()[1]
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != llm.RoleTool || last.ToolCallID != "call_1" {
+		t.Fatalf("every tool call needs a tool message, got %+v", last)
+	}
+	if !strings.Contains(last.Content, `"error":"unknown_tool"`) || !strings.Contains(last.Content, `"available_tools":["get_weather","web_search"]`) {
+		t.Fatalf("unexpected report: %s", last.Content)
+	}
+}
+
+func TestUnknownToolFuzzyMatch(t *testing.T) {
+	model := newFakeChatModel(
+		toolCallResponse(
+			llm.ToolCall{ID: "call_1", Name: "getWeather", Arguments: `{}`},
+			llm.ToolCall{ID: "call_2", Name: "send_email", Arguments: `{}`},
+		),
+		textResponse("done"),
+	)
+	a := NewAgent(model, true)
+	a.UnknownToolPolicy = UnknownToolFuzzyMatch
+	a.RegisterTool(echoTool("get_weather"))
+
+	if _, err := a.Invoke(context.Background(), "weather?"); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	msgs := model.Requests()[1].Messages
+	matched, unmatched := msgs[len(msgs)-2], msgs[len(msgs)-1]
+	if !strings.Contains(matched.Content, `"get_weather" was called instead`) || !strings.HasSuffix(matched.Content, "get_weather:{}") {
+		t.Fatalf("near miss should run get_weather, got %q", matched.Content)
+	}
+	if !strings.Contains(unmatched.Content, `"error":"unknown_tool"`) {
+		t.Fatalf("distant name should be reported, got %q", unmatched.Content)
+	}
+}
+
+func TestUnknownToolFail(t *testing.T) {
+	ran := false
+	model := newFakeChatModel(
+		toolCallResponse(
+			llm.ToolCall{ID: "call_1", Name: "echo", Arguments: `{}`},
+			llm.ToolCall{ID: "call_2", Name: "missing", Arguments: `{}`},
+		),
+	)
+	a := NewAgent(model, true)
+	a.UnknownToolPolicy = UnknownToolFail
+	a.RegisterTool(echoTool("echo"))
+	a.Use(func(next tools.ToolHandler) tools.ToolHandler {
+		ran = true
+		return next
+	})
+
+	_, err := a.Invoke(context.Background(), "go")
+	var unknown *UnknownToolError
+	if !errors.Is(err, ErrUnknownTool) || !errors.As(err, &unknown) || unknown.Name != "missing" {
+		t.Fatalf("want UnknownToolError for missing, got %v", err)
+	}
+	if ran {
+		t.Fatal("no tool should run when the invocation fails")
+	}
+}
+
+func TestLoadAgentConfigRejectsUnknownToolPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "agent.yaml"), []byte("unknown_tool_policy: fuzzy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadAgentConfig(dir)
+	if err == nil || !strings.Contains(err.Error(), "report, fuzzy_match or fail") {
+		t.Fatalf("err = %v, want the valid policies named", err)
+	}
+}
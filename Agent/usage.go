@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"strings"
+	"sync"
+
+	"agent/llm"
+	"agent/memory"
+)
+
+// InvokeResult is the outcome of one invocation.
+type InvokeResult struct {
+	Content string    `json:"content"`
+	Model   string    `json:"model"` // model that produced the last completion, e.g. a fallback
+	Usage   llm.Usage `json:"usage"` // summed over every round of the tool loop
+	Cost    float64   `json:"cost"`  // estimated from the agent's PriceTable
+
+	// Partial is set when the invocation was cut short and Content is the
+	// model's best-effort answer from what it had gathered; StopReason says
+	// why it stopped.
+	Partial    bool  `json:"partial,omitempty"`
+	StopReason error `json:"-"`
+
+	// Trace lists the tool calls and the final answer step by step.
+	Trace []TraceStep `json:"trace,omitempty"`
+	// Memories are the long-term memories recalled into the prompt.
+	Memories []memory.Match `json:"memories,omitempty"`
+}
+
+// ModelPrice is the price of a model per million tokens.
+type ModelPrice struct {
+	Input       float64 `mapstructure:"input" json:"input"`
+	CachedInput float64 `mapstructure:"cached_input" json:"cached_input"` // falls back to Input when 0
+	Output      float64 `mapstructure:"output" json:"output"`
+}
+
+// PriceTable maps model names to prices. Lookup falls back to the longest
+// key that prefixes the model name, so "gpt-4o-mini" also prices
+// "gpt-4o-mini-2024-07-18".
+type PriceTable map[string]ModelPrice
+
+func (p PriceTable) Lookup(model string) (ModelPrice, bool) {
+	model = strings.ToLower(model)
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	bestKey := ""
+	for key := range p {
+		if strings.HasPrefix(model, strings.ToLower(key)) && len(key) > len(bestKey) {
+			bestKey = key
+		}
+	}
+	if bestKey == "" {
+		return ModelPrice{}, false
+	}
+	return p[bestKey], true
+}
+
+// Cost estimates the price of usage on model; unknown models cost 0.
+func (p PriceTable) Cost(model string, usage llm.Usage) float64 {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return 0
+	}
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	uncached := usage.PromptTokens - usage.CachedTokens
+	return (float64(uncached)*price.Input +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CompletionTokens)*price.Output) / 1e6
+}
+
+// UsageStats is a running total of usage and estimated cost.
+type UsageStats struct {
+	Usage       llm.Usage `json:"usage"`
+	Cost        float64   `json:"cost"`
+	Invocations int       `json:"invocations"`
+}
+
+// Add returns the sum of two totals.
+func (s UsageStats) Add(other UsageStats) UsageStats {
+	s.Usage = s.Usage.Add(other.Usage)
+	s.Cost += other.Cost
+	s.Invocations += other.Invocations
+	return s
+}
+
+// usageCounter accumulates UsageStats safely across goroutines.
+type usageCounter struct {
+	mu    sync.Mutex
+	stats UsageStats
+}
+
+func (c *usageCounter) record(result *InvokeResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = c.stats.Add(UsageStats{Usage: result.Usage, Cost: result.Cost, Invocations: 1})
+}
+
+func (c *usageCounter) snapshot() UsageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Usage returns the totals of every invocation run by this agent.
+func (a *Agent) Usage() UsageStats {
+	return a.usage.snapshot()
+}
+
+// Usage returns the totals of every invocation run in this conversation.
+func (c *Conversation) Usage() UsageStats {
+	return c.usage.snapshot()
+}
+
+// addRound adds the usage of one completion to result, records the model
+// that answered and returns its estimated cost.
+func (a *Agent) addRound(result *InvokeResult, resp *llm.Response) float64 {
+	result.Model = respondingModel(a.model, resp)
+	return a.countUsage(result, a.model, resp)
+}
+
+// countUsage adds the usage of a completion by model to result without
+// changing result.Model, e.g. for the reflection critic, and returns its
+// estimated cost.
+func (a *Agent) countUsage(result *InvokeResult, model llm.ChatModel, resp *llm.Response) float64 {
+	cost := a.Prices.Cost(respondingModel(model, resp), resp.Usage)
+	result.Usage = result.Usage.Add(resp.Usage)
+	result.Cost += cost
+	return cost
+}
+
+func respondingModel(model llm.ChatModel, resp *llm.Response) string {
+	if resp.Model != "" {
+		return resp.Model
+	}
+	return model.ModelName()
+}
+
+// recordUsage rolls an invocation up into the agent and session totals.
+func (a *Agent) recordUsage(conv *Conversation, result *InvokeResult) {
+	a.usage.record(result)
+	for ; conv != nil; conv = conv.parent {
+		conv.usage.record(result)
+	}
+}
@@ -4,7 +4,10 @@ go 1.25.4
 
 replace agent => ./Agent
 
-require agent v0.0.0-00010101000000-000000000000
+require (
+	agent v0.0.0-00010101000000-000000000000
+	github.com/panjf2000/ants/v2 v2.11.3
+)
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
@@ -23,6 +26,7 @@ require (
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
+	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 )
@@ -3,16 +3,28 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
 	"agent"
+	"agent/embedding"
+	"agent/llm"
+	"agent/memory"
+	"agent/tools"
 	"agent/tools/buildin"
+
+	"github.com/panjf2000/ants/v2"
 )
 
 func main() {
+	showTrace := flag.Bool("trace", false, "print the step trace of each answer as JSON")
+	flag.Parse()
+
 	cfg, err := agent.LoadAgentConfig(".")
 	if err != nil {
 		log.Fatalf("load config: %v", err)
@@ -25,28 +37,76 @@ func main() {
 	}
 
 	var chatAgent interface {
-		Invoke(context.Context, string) (string, error)
+		InvokeStreamWithAttachments(context.Context, string, ...llm.ContentPart) <-chan agent.StreamEvent
 	}
 	var base *agent.Agent
+	var planAgent *agent.PlanExecuteAgent
+	model, err := agent.NewChatModel(cfg)
+	if err != nil {
+		log.Fatalf("model config: %v", err)
+	}
 
-	if cfg.ReAct.Enabled {
-		reactAgent := agent.NewReActAgent(cfg.APIKey, cfg.BaseURL, cfg.Model)
-		reactAgent.Temperature = cfg.Temperature
-		reactAgent.Maxcircle = cfg.MaxCircle
+	if cfg.PlanExecute.Enabled {
+		planAgent = agent.NewPlanExecuteAgent(model)
+		planAgent.MaxSteps = cfg.PlanExecute.MaxSteps
+		base = planAgent.Executor
+	} else if cfg.ReAct.Enabled {
+		reactAgent := agent.NewReActAgent(model)
+		if cfg.ReAct.Mode == "text" {
+			reactAgent = agent.NewReActTextAgent(model)
+		}
 		base = reactAgent.Agent
 		chatAgent = reactAgent
 	} else {
-		baseAgent := agent.NewAgent(cfg.APIKey, cfg.BaseURL, cfg.Model, cfg.AllowTools)
-		baseAgent.Temperature = cfg.Temperature
-		baseAgent.Maxcircle = cfg.MaxCircle
-		base = baseAgent
-		chatAgent = baseAgent
+		base = agent.NewAgent(model, cfg.AllowTools)
+		chatAgent = base
+	}
+
+	policy, err := agent.NewContextPolicy(cfg.Context.Policy, cfg.Context.MaxToolResultChars, model)
+	if err != nil {
+		log.Fatalf("context policy: %v", err)
+	}
+	configureAgent(base, cfg, policy)
+	if planAgent != nil {
+		configureAgent(planAgent.Planner, cfg, policy)
+	}
+	if cfg.Reflection.Enabled {
+		var critic llm.ChatModel
+		if cfg.Reflection.Model != "" {
+			critic = llm.NewOpenAIChatModel(cfg.APIKey, cfg.BaseURL, cfg.Reflection.Model)
+		}
+		base.Reflection = &agent.Reflection{Critic: critic, MaxRounds: cfg.Reflection.MaxRounds}
+	}
+
+	if cfg.Prompts.System != "" {
+		prompts, err := agent.LoadPromptDir(cfg.Prompts.Dir)
+		if err != nil {
+			log.Fatalf("load prompts: %v", err)
+		}
+		system, err := prompts.Get(cfg.Prompts.System)
+		if err != nil {
+			log.Fatalf("system prompt: %v", err)
+		}
+		base.SetSystemTemplate(system)
+		base.PromptVars = cfg.Prompts.Vars
+	}
+
+	var memories *memory.VectorStore
+	if cfg.Memory.Enabled {
+		memories, err = newMemoryStore(cfg)
+		if err != nil {
+			log.Fatalf("memory: %v", err)
+		}
+		base.MemoryStore = memories
+		base.MemoryTopK = cfg.Memory.TopK
 	}
 
 	registerTools(base)
 
-	fmt.Println("Simple chat agent with tools. Type 'exit' to quit.")
+	fmt.Println("Simple chat agent with tools. Type '/attach <path>' to send a file with your next message, '/remember <fact>', '/forget <id>' or '/memories' to manage long-term memory, '/usage' for token usage, '/reset' to clear the conversation, 'exit' to quit.")
 	scanner := bufio.NewScanner(os.Stdin)
+	base.SetApprover(agent.NewTerminalApprover(scanner, os.Stdout))
+	var attachments []llm.ContentPart
 	for {
 		fmt.Print("You> ")
 		if !scanner.Scan() {
@@ -59,14 +119,47 @@ func main() {
 		if text == "exit" || text == "quit" {
 			break
 		}
-		reply, err := chatAgent.Invoke(context.Background(), text)
-		if err != nil {
-			log.Printf("agent error: %v", err)
+		if text == "/usage" {
+			if planAgent != nil {
+				printUsage(planAgent.Usage())
+			} else {
+				printUsage(base.Usage())
+			}
+			continue
+		}
+		if path, ok := strings.CutPrefix(text, "/attach "); ok {
+			part, err := llm.PartFromPath(strings.TrimSpace(path))
+			if err != nil {
+				log.Printf("attach: %v", err)
+				continue
+			}
+			attachments = append(attachments, part)
+			fmt.Printf("Attached %s (%d pending for your next message).\n", strings.TrimSpace(path), len(attachments))
 			continue
 		}
-		fmt.Printf("Agent> %s\n", reply)
-		if base != nil {
-			base.AddMemory(reply)
+		if memories != nil && handleMemoryCommand(base, memories, cfg.Memory.File, text) {
+			continue
+		}
+		if text == "/reset" {
+			base.ResetConversation()
+			fmt.Println("Conversation cleared.")
+			continue
+		}
+		if planAgent != nil {
+			if len(attachments) > 0 {
+				log.Printf("attachments are not supported in plan_execute mode; dropped %d", len(attachments))
+				attachments = nil
+			}
+			if err := planReply(planAgent, text, *showTrace); err != nil {
+				log.Printf("agent error: %v", err)
+			}
+			continue
+		}
+		events := chatAgent.InvokeStreamWithAttachments(context.Background(), text, attachments...)
+		attachments = nil
+		if _, err := streamReply(events, *showTrace); err != nil {
+			log.Printf("agent error: %v", err)
+			continue
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -74,11 +167,197 @@ func main() {
 	}
 }
 
+// configureAgent applies the loop, tool, retry, pricing, budget and context
+// settings of cfg to a.
+func configureAgent(a *agent.Agent, cfg *agent.AgentConfig, policy agent.ContextPolicy) {
+	a.Temperature = cfg.Temperature
+	a.Maxcircle = cfg.MaxCircle
+	a.FinalAnswerOnLimit = cfg.FinalAnswerOnLimit
+	a.Retry = cfg.Retry
+	a.MaxParallelTools = cfg.MaxParallelTools
+	a.SetSerialTools(cfg.SerialTools...)
+	// LoadAgentConfig has validated the policy.
+	a.UnknownToolPolicy, _ = agent.ParseUnknownToolPolicy(cfg.UnknownToolPolicy)
+	a.ToolTimeout = cfg.ToolTimeout
+	a.Prices = cfg.Pricing
+	a.InvokeBudget = cfg.Budget.Invocation
+	a.SessionBudget = cfg.Budget.Session
+	a.BudgetFinalAnswer = cfg.Budget.FinalAnswer
+	a.ContextBudget = cfg.Context.Budget
+	a.ContextPolicy = policy
+}
+
+// newMemoryStore builds the vector memory and loads memory.file if it
+// exists.
+func newMemoryStore(cfg *agent.AgentConfig) (*memory.VectorStore, error) {
+	apiKey, baseURL := cfg.Memory.APIKey, cfg.Memory.BaseURL
+	if apiKey == "" {
+		apiKey = cfg.APIKey
+	}
+	if baseURL == "" {
+		baseURL = cfg.BaseURL
+	}
+	pool, err := ants.NewPool(4)
+	if err != nil {
+		return nil, err
+	}
+	pooler := embedding.NewBatchEmbedder(pool)
+	embedder, err := embedding.NewEmbedder(embedding.Config{
+		APIKey:     apiKey,
+		BaseURL:    baseURL,
+		ModelName:  cfg.Memory.Model,
+		Dimensions: cfg.Memory.Dimensions,
+	}, pooler)
+	if err != nil {
+		return nil, err
+	}
+	store := memory.NewVectorStore(embedder)
+	store.Pool = pooler
+	store.MinScore = cfg.Memory.MinScore
+	if cfg.Memory.File == "" {
+		return store, nil
+	}
+	f, err := os.Open(cfg.Memory.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return store, store.Load(f)
+}
+
+// handleMemoryCommand runs /remember, /forget and /memories and reports
+// whether text was one of them.
+func handleMemoryCommand(a *agent.Agent, store *memory.VectorStore, file, text string) bool {
+	ctx := context.Background()
+	switch {
+	case text == "/memories":
+		list, _ := store.List(ctx)
+		for _, m := range list {
+			fmt.Printf("%s  %s  %s\n", m.ID, m.CreatedAt.Format("2006-01-02"), m.Text)
+		}
+		if len(list) == 0 {
+			fmt.Println("No memories.")
+		}
+		return true
+	case strings.HasPrefix(text, "/remember "):
+		id, err := a.Remember(ctx, memory.Memory{Text: strings.TrimSpace(strings.TrimPrefix(text, "/remember ")), Source: "user", Importance: 1})
+		if err != nil {
+			log.Printf("remember: %v", err)
+			return true
+		}
+		fmt.Printf("Remembered as %s.\n", id)
+	case strings.HasPrefix(text, "/forget "):
+		if err := a.Forget(ctx, strings.Fields(strings.TrimPrefix(text, "/forget "))...); err != nil {
+			log.Printf("forget: %v", err)
+			return true
+		}
+		fmt.Println("Forgotten.")
+	default:
+		return false
+	}
+	if file != "" {
+		if err := saveMemories(store, file); err != nil {
+			log.Printf("save memories: %v", err)
+		}
+	}
+	return true
+}
+
+func saveMemories(store *memory.VectorStore, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := store.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printUsage(stats agent.UsageStats) {
+	fmt.Printf("Usage: %d invocation(s), prompt=%d (cached %d) completion=%d total=%d tokens, est. cost $%.6f\n",
+		stats.Invocations, stats.Usage.PromptTokens, stats.Usage.CachedTokens,
+		stats.Usage.CompletionTokens, stats.Usage.TotalTokens, stats.Cost)
+}
+
+// streamReply prints text deltas as they arrive and returns the final answer.
+// With showTrace the steps behind the answer are printed after it.
+func streamReply(events <-chan agent.StreamEvent, showTrace bool) (string, error) {
+	var reply string
+	var final *agent.InvokeResult
+	var err error
+	fmt.Print("Agent> ")
+	for ev := range events {
+		switch ev.Type {
+		case agent.StreamEventTextDelta:
+			fmt.Print(ev.Delta)
+		case agent.StreamEventToolCall:
+			fmt.Printf("\n[tool] %s(%s)\n", ev.ToolName, ev.Arguments)
+		case agent.StreamEventFinal:
+			reply = ev.Content
+			final = ev.Final
+			if ev.Final != nil && ev.Final.Partial {
+				fmt.Printf("\n[partial answer: %v]", ev.Final.StopReason)
+			}
+		case agent.StreamEventError:
+			err = ev.Err
+		}
+	}
+	fmt.Println()
+	if showTrace && final != nil {
+		printTrace(final.Trace)
+	}
+	return reply, err
+}
+
+// planReply runs the plan-and-execute agent and prints the plan, each step
+// outcome and the answer.
+func planReply(p *agent.PlanExecuteAgent, objective string, showTrace bool) error {
+	result, err := p.InvokePlan(context.Background(), objective)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Plan:")
+	for i, step := range result.Plan {
+		fmt.Printf("  %d. %s\n", i+1, step)
+	}
+	for i, step := range result.Steps {
+		fmt.Printf("[step %d] %s\n", i+1, step.Step)
+		if step.Error != "" {
+			fmt.Printf("  failed: %s\n", step.Error)
+		}
+		if step.Result != "" {
+			fmt.Printf("  %s\n", step.Result)
+		}
+	}
+	fmt.Printf("Agent> %s\n", result.Content)
+	if result.Partial {
+		fmt.Printf("[partial answer: %v]\n", result.StopReason)
+	}
+	if showTrace {
+		printTrace(result.Trace)
+	}
+	return nil
+}
+
+func printTrace(trace []agent.TraceStep) {
+	data, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		log.Printf("trace: %v", err)
+		return
+	}
+	fmt.Printf("Trace:\n%s\n", data)
+}
+
 func registerTools(a *agent.Agent) {
 	if a == nil {
 		return
 	}
 	a.RegisterTool(buildin.NewWebSearchTool())
-	a.RegisterTool(buildin.NewGetWeatherTool())
+	a.RegisterTool(buildin.NewGetWeatherTool().With(tools.WithApproval()))
 	a.RegisterTool(buildin.NewGetCurrentTimeTool())
 }